@@ -0,0 +1,167 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/admin (lee8oi)
+
+auth contains the user accounts, password hashing & sessions used by the panel.
+*/
+
+package admin
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"time"
+)
+
+//iterations is the PBKDF2 iteration count used for new passwords.
+const iterations = 100000
+
+//sessionLife is how long a login lasts.
+const sessionLife = 12 * time.Hour
+
+//User is a panel account. Passwords are stored as salted PBKDF2-SHA256 hashes and
+//tokens as SHA-256 hashes, never in plain text.
+type User struct {
+	Salt, Hash string
+	Iterations int
+	Tokens     []string
+}
+
+type session struct {
+	user    string
+	expires time.Time
+}
+
+//loadUsers reads the user accounts from path.
+func loadUsers(path string) (map[string]User, error) {
+	users := make(map[string]User)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return users, err
+	}
+	err = json.Unmarshal(b, &users)
+	return users, err
+}
+
+//SetPassword creates or updates a user account in the users file at path.
+func SetPassword(path, name, password string) error {
+	if name == "" || password == "" {
+		return errors.New("name & password are required")
+	}
+	users, _ := loadUsers(path)
+	u := users[name]
+	u.Salt = random(16)
+	u.Iterations = iterations
+	u.Hash = hex.EncodeToString(pbkdf2([]byte(password), []byte(u.Salt), u.Iterations, 32))
+	users[name] = u
+	return saveUsers(path, users)
+}
+
+//NewToken creates an access token for a user in the users file at path. The token
+//is returned once, only its hash is stored.
+func NewToken(path, name string) (string, error) {
+	users, err := loadUsers(path)
+	if err != nil {
+		return "", err
+	}
+	u, ok := users[name]
+	if !ok {
+		return "", errors.New("no user " + name)
+	}
+	token := random(32)
+	u.Tokens = append(u.Tokens, tokenHash(token))
+	users[name] = u
+	return token, saveUsers(path, users)
+}
+
+func saveUsers(path string, users map[string]User) error {
+	b, err := json.MarshalIndent(users, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0600)
+}
+
+//CheckToken returns the name of the user owning token in the users file at path.
+func CheckToken(path, token string) (string, bool) {
+	users, _ := loadUsers(path)
+	for name, u := range users {
+		if u.hasToken(token) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+//check returns true if password matches the user's hash.
+func (u *User) check(password string) bool {
+	if u.Hash == "" || u.Iterations <= 0 {
+		return false
+	}
+	want, err := hex.DecodeString(u.Hash)
+	if err != nil {
+		return false
+	}
+	got := pbkdf2([]byte(password), []byte(u.Salt), u.Iterations, len(want))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+//hasToken returns true if token belongs to the user.
+func (u *User) hasToken(token string) bool {
+	h := tokenHash(token)
+	for _, t := range u.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(h)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+//random returns n random bytes hex encoded.
+func random(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+//pbkdf2 derives a key from password & salt (RFC 2898 with HMAC-SHA256).
+func pbkdf2(password, salt []byte, iter, size int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < size; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], block)
+		prf.Write(n[:])
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iter; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:size]
+}
@@ -0,0 +1,234 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/admin (lee8oi)
+
+*/
+
+/*
+The admin package serves a web admin panel for running Trackers. Users log in with
+a password (or send an access token) and can watch the players, server info & chat
+of each server and kick, ban, say & change maps. Every action is written to the
+audit log.
+
+Accounts are kept in a JSON users file, create them with SetPassword.
+*/
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lee8oi/gorcon/track"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Panel is the web admin panel.
+type Panel struct {
+	trackers map[string]*track.Tracker
+	users    string
+	audit    string
+	sessions map[string]session
+	mu       sync.Mutex
+}
+
+//New returns a Panel for trackers (keyed by Tracker.ID) using the users file &
+//appending to the audit log file.
+func New(trackers map[string]*track.Tracker, users, audit string) *Panel {
+	return &Panel{
+		trackers: trackers,
+		users:    users,
+		audit:    audit,
+		sessions: make(map[string]session),
+	}
+}
+
+//Register adds the panel handlers under /admin/ to mux.
+func (p *Panel) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/admin/", p.page)
+	mux.HandleFunc("/admin/login", p.login)
+	mux.HandleFunc("/admin/logout", p.logout)
+	mux.HandleFunc("/admin/state", p.auth(p.state))
+	mux.HandleFunc("/admin/action", p.auth(p.action))
+}
+
+//user returns the name of the logged in user, from the session cookie or an
+//"Authorization: Bearer <token>" header.
+func (p *Panel) user(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		name, _ := CheckToken(p.users, strings.TrimPrefix(h, "Bearer "))
+		return name
+	}
+	c, err := r.Cookie("gorcon")
+	if err != nil {
+		return ""
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.sessions[c.Value]
+	if !ok || time.Now().After(s.expires) {
+		delete(p.sessions, c.Value)
+		return ""
+	}
+	return s.user
+}
+
+//auth wraps handlers that need a logged in user. Requests using the session cookie
+//must also send the X-Gorcon header, which browsers won't add cross-site.
+func (p *Panel) auth(f func(w http.ResponseWriter, r *http.Request, user string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := p.user(r)
+		if user == "" {
+			http.Error(w, "not logged in", http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("Authorization") == "" && r.Header.Get("X-Gorcon") == "" {
+			http.Error(w, "missing X-Gorcon header", http.StatusForbidden)
+			return
+		}
+		f(w, r, user)
+	}
+}
+
+func (p *Panel) page(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if p.user(r) == "" {
+		fmt.Fprint(w, loginPage)
+		return
+	}
+	fmt.Fprint(w, panelPage)
+}
+
+func (p *Panel) login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/admin/", http.StatusSeeOther)
+		return
+	}
+	name, pass := r.FormValue("user"), r.FormValue("password")
+	users, _ := loadUsers(p.users)
+	u, ok := users[name]
+	if !ok || !u.check(pass) {
+		p.Record(name, "-", "login failed", r.RemoteAddr)
+		time.Sleep(time.Second)
+		http.Redirect(w, r, "/admin/?failed", http.StatusSeeOther)
+		return
+	}
+	id := random(32)
+	p.mu.Lock()
+	p.sessions[id] = session{user: name, expires: time.Now().Add(sessionLife)}
+	p.mu.Unlock()
+	http.SetCookie(w, &http.Cookie{
+		Name:     "gorcon",
+		Value:    id,
+		Path:     "/admin/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int(sessionLife / time.Second),
+	})
+	p.Record(name, "-", "login", r.RemoteAddr)
+	http.Redirect(w, r, "/admin/", http.StatusSeeOther)
+}
+
+func (p *Panel) logout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie("gorcon"); err == nil {
+		p.mu.Lock()
+		delete(p.sessions, c.Value)
+		p.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: "gorcon", Path: "/admin/", MaxAge: -1})
+	http.Redirect(w, r, "/admin/", http.StatusSeeOther)
+}
+
+//state returns the status of every server as JSON.
+func (p *Panel) state(w http.ResponseWriter, r *http.Request, user string) {
+	list := make(map[string]track.Status)
+	for id, t := range p.trackers {
+		list[id] = t.Status()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+//request is the JSON body of an action.
+type request struct {
+	Server, Action, Name, Reason, Text, Duration string
+	Pid, Map                                     int
+}
+
+//action runs a kick, ban, say or map action.
+func (p *Panel) action(w http.ResponseWriter, r *http.Request, user string) {
+	if r.Method != "POST" {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	t, ok := p.trackers[req.Server]
+	if !ok {
+		http.Error(w, "unknown server", http.StatusNotFound)
+		return
+	}
+	var err error
+	detail := ""
+	switch req.Action {
+	case "kick":
+		detail = fmt.Sprintf("%s (%s)", req.Name, req.Reason)
+		err = t.Kick(req.Pid, req.Name, req.Reason, user)
+	case "ban":
+		var dur time.Duration
+		if req.Duration != "" {
+			if dur, err = track.ParseDuration(req.Duration); err != nil {
+				break
+			}
+		}
+		detail = fmt.Sprintf("%s for %s (%s)", req.Name, req.Duration, req.Reason)
+		err = t.Ban(req.Pid, req.Name, req.Reason, user, dur)
+	case "say":
+		detail = req.Text
+		err = t.Say(req.Text)
+	case "map":
+		detail = strconv.Itoa(req.Map)
+		err = t.Map(req.Map)
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		p.Record(user, req.Server, req.Action+" failed", err.Error())
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	p.Record(user, req.Server, req.Action, detail)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//fields escapes the characters that separate audit log fields & entries.
+var fields = strings.NewReplacer("\\", `\\`, "\t", `\t`, "\r", `\r`, "\n", `\n`)
+
+//field returns s escaped for the audit log.
+func field(s string) string {
+	return fields.Replace(s)
+}
+
+//Record appends an entry to the audit log.
+func (p *Panel) Record(user, server, action, detail string) {
+	line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\n", time.Now().Format(time.RFC3339),
+		field(user), field(server), field(action), field(detail))
+	f, err := os.OpenFile(p.audit, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer f.Close()
+	f.WriteString(line)
+}
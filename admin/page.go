@@ -0,0 +1,159 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/admin (lee8oi)
+
+page holds the panel HTML. It is kept in the binary so the panel works from any
+working directory.
+*/
+
+package admin
+
+const style = `<style type="text/css">
+body { font-family: sans-serif; background: gray; margin: 0; padding: 0.5em; }
+.box { background: white; padding: 0.5em; margin-bottom: 0.5em; }
+table { border-collapse: collapse; width: 100%; }
+td, th { text-align: left; padding: 0.2em 0.5em; border-bottom: 1px solid #ddd; }
+#chat { height: 15em; overflow: auto; }
+#error { color: red; }
+</style>`
+
+const loginPage = `<html>
+<head>
+<title>gorcon admin</title>
+` + style + `
+</head>
+<body>
+<div class="box">
+<form method="post" action="/admin/login">
+    <input type="text" name="user" placeholder="user"/>
+    <input type="password" name="password" placeholder="password"/>
+    <input type="submit" value="Log in"/>
+</form>
+</div>
+</body>
+</html>`
+
+const panelPage = `<html>
+<head>
+<title>gorcon admin</title>
+` + style + `
+<script type="text/javascript">
+var server = "";
+
+function el(tag, text) {
+    var e = document.createElement(tag);
+    if (text !== undefined) e.textContent = text;
+    return e;
+}
+
+function act(body) {
+    body.Server = server;
+    var x = new XMLHttpRequest();
+    x.open("POST", "/admin/action");
+    x.setRequestHeader("X-Gorcon", "1");
+    x.setRequestHeader("Content-Type", "application/json");
+    x.onload = function() {
+        document.getElementById("error").textContent = x.status >= 300 ? x.responseText : "";
+    };
+    x.send(JSON.stringify(body));
+}
+
+function render(list) {
+    var sel = document.getElementById("server");
+    var ids = Object.keys(list).sort();
+    if (sel.options.length != ids.length) {
+        sel.innerHTML = "";
+        ids.forEach(function(id) { sel.appendChild(el("option", id)); });
+    }
+    if (!server || !list[server]) server = ids[0];
+    sel.value = server;
+    var s = list[server];
+    if (!s) return;
+    var g = s.Game;
+    document.getElementById("info").textContent = g.Name + " - " + g.Map + " (" + g.Mode + ") - players " +
+        g.Players + " - National " + g.Ntickets + " / Royal " + g.Rtickets + " tickets - " +
+        g.Elapsed + "s elapsed, " + g.Remaining + "s left - rcon " + s.Rcon;
+    var tb = document.getElementById("players");
+    tb.innerHTML = "";
+    (s.Players || []).forEach(function(p) {
+        var tr = el("tr");
+        [p.Pid, p.Name, p.Team == "1" ? "National" : "Royal", p.Score, p.Kills, p.Deaths, p.Ping, p.Idle].forEach(function(v) {
+            tr.appendChild(el("td", v));
+        });
+        var td = el("td");
+        var kick = el("button", "kick");
+        kick.onclick = function() {
+            var reason = prompt("Kick " + p.Name + ", reason:");
+            if (reason !== null) act({Action: "kick", Pid: p.Pid, Name: p.Name, Reason: reason});
+        };
+        var ban = el("button", "ban");
+        ban.onclick = function() {
+            var reason = prompt("Ban " + p.Name + ", reason:");
+            if (reason === null) return;
+            var dur = prompt("Duration (e.g. 24h or 7d, empty for permanent):", "");
+            if (dur !== null) act({Action: "ban", Pid: p.Pid, Name: p.Name, Reason: reason, Duration: dur});
+        };
+        td.appendChild(kick);
+        td.appendChild(ban);
+        tr.appendChild(td);
+        tb.appendChild(tr);
+    });
+    var chat = document.getElementById("chat");
+    chat.innerHTML = "";
+    (s.Chat || []).forEach(function(m) {
+        chat.appendChild(el("div", m.Origin + " [" + m.Time + "]: " + m.Text));
+    });
+    chat.scrollTop = chat.scrollHeight;
+}
+
+function poll() {
+    var x = new XMLHttpRequest();
+    x.open("GET", "/admin/state");
+    x.setRequestHeader("X-Gorcon", "1");
+    x.onload = function() {
+        if (x.status == 401) { location.reload(); return; }
+        if (x.status == 200) render(JSON.parse(x.responseText));
+    };
+    x.send();
+}
+
+window.onload = function() {
+    document.getElementById("server").onchange = function() { server = this.value; poll(); };
+    document.getElementById("say").onsubmit = function() {
+        var t = document.getElementById("text");
+        if (t.value) act({Action: "say", Text: t.value});
+        t.value = "";
+        return false;
+    };
+    document.getElementById("map").onsubmit = function() {
+        var i = parseInt(document.getElementById("index").value, 10);
+        if (!isNaN(i) && confirm("Change to map " + i + "?")) act({Action: "map", Map: i});
+        return false;
+    };
+    poll();
+    setInterval(poll, 2000);
+};
+</script>
+</head>
+<body>
+<div class="box">
+    <select id="server"></select> <span id="info"></span>
+    <a href="/admin/logout" style="float: right">log out</a>
+    <div id="error"></div>
+</div>
+<div class="box">
+<table>
+<thead><tr><th>Id</th><th>Name</th><th>Team</th><th>Score</th><th>Kills</th><th>Deaths</th><th>Ping</th><th>Idle</th><th></th></tr></thead>
+<tbody id="players"></tbody>
+</table>
+</div>
+<div class="box">
+<div id="chat"></div>
+<form id="say"><input type="text" id="text" size="64"/> <input type="submit" value="Say"/></form>
+<form id="map">Map list index <input type="text" id="index" size="4"/> <input type="submit" value="Change map"/></form>
+</div>
+</body>
+</html>`
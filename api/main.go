@@ -0,0 +1,308 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/api (lee8oi)
+
+*/
+
+/*
+The api package serves a JSON HTTP API for running Trackers:
+
+	GET  /api/servers
+	GET  /api/servers/{id}/players
+	GET  /api/servers/{id}/game
+	GET  /api/servers/{id}/chat?since=RFC3339
+	GET  /api/servers/{id}/bans
+	GET  /api/servers/{id}/clans
+	GET  /api/servers/{id}/match
+	GET  /api/servers/{id}/whois?q=name|nucleus|profile
+	GET  /api/servers/{id}/archive?text=&player=&type=chat,moderation&from=&to=&limit=&format=json|csv
+	POST /api/servers/{id}/bans  {"<nucleus id>": {"Name": "...", "Reason": "...", ...}, ...}
+	POST /api/servers/{id}/say   {"Text": "..."}
+	POST /api/servers/{id}/kick  {"Pid": 3, "Name": "...", "Reason": "..."}
+	POST /api/servers/{id}/ban   {"Pid": 3, "Name": "...", "Reason": "...", "Duration": "7d"}
+	POST /api/servers/{id}/map   {"Index": 2}
+	POST /api/servers/{id}/relay {"Name": "...", "Text": "..."}
+	GET  /api/openapi.json
+
+Every request needs an "Authorization: Bearer <token>" header. Errors are returned
+as {"error": {"code": 404, "message": "..."}}.
+*/
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lee8oi/gorcon/track"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//API serves the HTTP API.
+type API struct {
+	trackers map[string]*track.Tracker
+	check    func(token string) (user string, ok bool)
+	audit    func(user, server, action, detail string)
+}
+
+//New returns an API for trackers (keyed by Tracker.ID). Check validates access
+//tokens, audit (may be nil) records every action.
+func New(trackers map[string]*track.Tracker, check func(string) (string, bool), audit func(user, server, action, detail string)) *API {
+	return &API{trackers: trackers, check: check, audit: audit}
+}
+
+//Register adds the API handlers under /api/ to mux.
+func (a *API) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/api/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, openapi)
+	})
+	mux.Handle("/api/", a)
+}
+
+//apiError is the body of every error response.
+type apiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func fail(w http.ResponseWriter, code int, format string, a ...interface{}) {
+	var e apiError
+	e.Error.Code = code
+	e.Error.Message = fmt.Sprintf(format, a...)
+	reply(w, code, e)
+}
+
+func reply(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+//server is an entry in the /api/servers list.
+type server struct {
+	ID, Rcon, Name, Map, Mode string
+	Players                   int
+	Updated                   time.Time
+}
+
+//ServeHTTP routes API requests.
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h := r.Header.Get("Authorization")
+	user, ok := "", false
+	if strings.HasPrefix(h, "Bearer ") {
+		user, ok = a.check(strings.TrimPrefix(h, "Bearer "))
+	}
+	if !ok {
+		fail(w, http.StatusUnauthorized, "missing or invalid token")
+		return
+	}
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/"), "/"), "/")
+	if path[0] != "servers" || len(path) > 3 {
+		fail(w, http.StatusNotFound, "no such endpoint")
+		return
+	}
+	if len(path) == 1 {
+		if r.Method != "GET" {
+			fail(w, http.StatusMethodNotAllowed, "%s not allowed", r.Method)
+			return
+		}
+		list := []server{}
+		for _, t := range a.trackers {
+			s := t.Status()
+			list = append(list, server{
+				ID:      s.ID,
+				Rcon:    s.Rcon,
+				Name:    s.Game.Name,
+				Map:     s.Game.Map,
+				Mode:    s.Game.Mode,
+				Players: len(s.Players),
+				Updated: s.Updated,
+			})
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		reply(w, http.StatusOK, list)
+		return
+	}
+	t, ok := a.trackers[path[1]]
+	if !ok {
+		fail(w, http.StatusNotFound, "unknown server '%s'", path[1])
+		return
+	}
+	if len(path) == 2 {
+		fail(w, http.StatusNotFound, "no such endpoint")
+		return
+	}
+	switch r.Method {
+	case "GET":
+		a.get(w, r, t, path[2])
+	case "POST":
+		a.post(w, r, t, path[2], user)
+	default:
+		fail(w, http.StatusMethodNotAllowed, "%s not allowed", r.Method)
+	}
+}
+
+func (a *API) get(w http.ResponseWriter, r *http.Request, t *track.Tracker, what string) {
+	switch what {
+	case "players":
+		s := t.Status()
+		reply(w, http.StatusOK, s.Players)
+	case "game":
+		s := t.Status()
+		reply(w, http.StatusOK, s.Game)
+	case "chat":
+		var since time.Time
+		if v := r.URL.Query().Get("since"); v != "" {
+			var err error
+			if since, err = time.Parse(time.RFC3339Nano, v); err != nil {
+				fail(w, http.StatusBadRequest, "bad since: %s", err)
+				return
+			}
+		}
+		reply(w, http.StatusOK, t.Chat(since))
+	case "bans":
+		reply(w, http.StatusOK, t.Bans())
+	case "archive":
+		a.archive(w, r, t)
+	case "clans":
+		reply(w, http.StatusOK, t.Clans())
+	case "match":
+		reply(w, http.StatusOK, t.Match())
+	case "whois":
+		q := r.URL.Query().Get("q")
+		if q == "" {
+			fail(w, http.StatusBadRequest, "q is required")
+			return
+		}
+		list := t.Whois(q)
+		if list == nil {
+			list = []track.Identity{}
+		}
+		reply(w, http.StatusOK, list)
+	default:
+		fail(w, http.StatusNotFound, "no such endpoint")
+	}
+}
+
+//archive serves a search of the Tracker's archive as JSON or CSV.
+func (a *API) archive(w http.ResponseWriter, r *http.Request, t *track.Tracker) {
+	v := r.URL.Query()
+	q := track.Query{Text: v.Get("text"), Player: v.Get("player")}
+	if v.Get("type") != "" {
+		q.Types = strings.Split(v.Get("type"), ",")
+	}
+	for name, at := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if v.Get(name) == "" {
+			continue
+		}
+		var err error
+		if *at, err = time.Parse(time.RFC3339Nano, v.Get(name)); err != nil {
+			fail(w, http.StatusBadRequest, "bad %s: %s", name, err)
+			return
+		}
+	}
+	if v.Get("limit") != "" {
+		var err error
+		if q.Limit, err = strconv.Atoi(v.Get("limit")); err != nil {
+			fail(w, http.StatusBadRequest, "bad limit: %s", err)
+			return
+		}
+	}
+	format := v.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		fail(w, http.StatusBadRequest, "unknown format '%s'", format)
+		return
+	}
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s-archive.csv", t.ID))
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	if err := t.Export(w, q, format); err != nil {
+		fail(w, http.StatusInternalServerError, "%s", err)
+	}
+}
+
+//importBans merges a ban list, in the format served by GET .../bans, into the
+//Tracker's ban list.
+func (a *API) importBans(w http.ResponseWriter, r *http.Request, t *track.Tracker, user string) {
+	if err := t.ImportBans(r.Body); err != nil {
+		fail(w, http.StatusBadRequest, "bad ban list: %s", err)
+		return
+	}
+	if a.audit != nil {
+		a.audit(user, t.ID, "api import bans", "")
+	}
+	reply(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+//action is the JSON body of POST requests.
+type action struct {
+	Text, Name, Reason, Duration string
+	Pid, Index                   int
+}
+
+func (a *API) post(w http.ResponseWriter, r *http.Request, t *track.Tracker, what, user string) {
+	if what == "bans" {
+		a.importBans(w, r, t, user)
+		return
+	}
+	var req action
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		fail(w, http.StatusBadRequest, "bad body: %s", err)
+		return
+	}
+	var err error
+	detail := ""
+	switch what {
+	case "say":
+		if req.Text == "" {
+			fail(w, http.StatusBadRequest, "Text is required")
+			return
+		}
+		detail = req.Text
+		err = t.Say(req.Text)
+	case "kick":
+		detail = fmt.Sprintf("%s (%s)", req.Name, req.Reason)
+		err = t.Kick(req.Pid, req.Name, req.Reason, user)
+	case "ban":
+		var dur time.Duration
+		if req.Duration != "" {
+			if dur, err = track.ParseDuration(req.Duration); err != nil {
+				fail(w, http.StatusBadRequest, "bad Duration: %s", err)
+				return
+			}
+		}
+		detail = fmt.Sprintf("%s for %s (%s)", req.Name, req.Duration, req.Reason)
+		err = t.Ban(req.Pid, req.Name, req.Reason, user, dur)
+	case "map":
+		detail = fmt.Sprint(req.Index)
+		err = t.Map(req.Index)
+	case "relay":
+		detail = fmt.Sprintf("%s: %s", req.Name, req.Text)
+		err = t.Relay(req.Name, req.Text)
+	default:
+		fail(w, http.StatusNotFound, "no such endpoint")
+		return
+	}
+	if err != nil {
+		fail(w, http.StatusConflict, "%s", err)
+		return
+	}
+	if a.audit != nil {
+		a.audit(user, t.ID, "api "+what, detail)
+	}
+	reply(w, http.StatusOK, map[string]bool{"ok": true})
+}
@@ -0,0 +1,283 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/api (lee8oi)
+
+openapi holds the OpenAPI description served at /api/openapi.json.
+*/
+
+package api
+
+const openapi = `{
+  "openapi": "3.0.3",
+  "info": {"title": "gorcon API", "version": "1"},
+  "servers": [{"url": "/api"}],
+  "security": [{"token": []}],
+  "components": {
+    "securitySchemes": {"token": {"type": "http", "scheme": "bearer"}},
+    "parameters": {
+      "id": {"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}
+    },
+    "responses": {
+      "error": {
+        "description": "Error",
+        "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}
+      },
+      "ok": {
+        "description": "Done",
+        "content": {"application/json": {"schema": {"type": "object", "properties": {"ok": {"type": "boolean"}}}}}
+      }
+    },
+    "schemas": {
+      "Error": {
+        "type": "object",
+        "properties": {
+          "error": {
+            "type": "object",
+            "properties": {"code": {"type": "integer"}, "message": {"type": "string"}}
+          }
+        }
+      },
+      "Server": {
+        "type": "object",
+        "properties": {
+          "ID": {"type": "string"}, "Rcon": {"type": "string"}, "Name": {"type": "string"},
+          "Map": {"type": "string"}, "Mode": {"type": "string"}, "Players": {"type": "integer"},
+          "Updated": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Player": {
+        "type": "object",
+        "properties": {
+          "Pid": {"type": "integer"}, "Name": {"type": "string"}, "Profileid": {"type": "string"},
+          "Nucleus": {"type": "string"}, "Team": {"type": "string"}, "Level": {"type": "string"},
+          "Kit": {"type": "string"}, "Score": {"type": "string"}, "Kills": {"type": "string"},
+          "Deaths": {"type": "string"}, "Alive": {"type": "string"}, "Idle": {"type": "string"},
+          "Connected": {"type": "string"}, "Vip": {"type": "string"}, "Ping": {"type": "string"},
+          "Joined": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Game": {
+        "type": "object",
+        "properties": {
+          "Name": {"type": "string"}, "Ranked": {"type": "string"}, "Balance": {"type": "string"},
+          "Map": {"type": "string"}, "Mode": {"type": "string"}, "Round": {"type": "string"},
+          "Players": {"type": "string"}, "Joining": {"type": "string"},
+          "Ntickets": {"type": "string"}, "Nsize": {"type": "string"},
+          "Rtickets": {"type": "string"}, "Rsize": {"type": "string"},
+          "Elapsed": {"type": "string"}, "Remaining": {"type": "string"}
+        }
+      },
+      "Message": {
+        "type": "object",
+        "properties": {
+          "Pid": {"type": "string"}, "Origin": {"type": "string"}, "Team": {"type": "string"},
+          "Type": {"type": "string"}, "Time": {"type": "string"}, "Text": {"type": "string"},
+          "IsCommand": {"type": "boolean"}, "Received": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Ban": {
+        "type": "object",
+        "properties": {
+          "Name": {"type": "string"}, "Nucleus": {"type": "string"}, "Profileid": {"type": "string"},
+          "Reason": {"type": "string"}, "Admin": {"type": "string"},
+          "Issued": {"type": "string", "format": "date-time"},
+          "Expires": {"type": "string", "format": "date-time", "description": "zero time for permanent bans"}
+        }
+      },
+      "Identity": {
+        "type": "object",
+        "properties": {
+          "ID": {"type": "string"}, "Name": {"type": "string"}, "Profileid": {"type": "string"},
+          "First": {"type": "string", "format": "date-time"}, "Last": {"type": "string", "format": "date-time"},
+          "Visits": {"type": "integer"},
+          "Names": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "Name": {"type": "string"}, "Clan": {"type": "string"}, "Visits": {"type": "integer"},
+                "First": {"type": "string", "format": "date-time"}, "Last": {"type": "string", "format": "date-time"}
+              }
+            }
+          }
+        }
+      },
+      "Record": {
+        "type": "object",
+        "properties": {
+          "Time": {"type": "string", "format": "date-time"}, "Type": {"type": "string"},
+          "Name": {"type": "string"}, "Nucleus": {"type": "string"}, "Text": {"type": "string"}
+        }
+      },
+      "Action": {
+        "type": "object",
+        "properties": {
+          "Text": {"type": "string"}, "Pid": {"type": "integer"}, "Name": {"type": "string"},
+          "Reason": {"type": "string"}, "Duration": {"type": "string", "example": "7d", "description": "Go duration or days (\"7d\"), empty for permanent"},
+          "Index": {"type": "integer"}
+        }
+      }
+    }
+  },
+  "paths": {
+    "/servers": {
+      "get": {
+        "summary": "List servers",
+        "responses": {
+          "200": {"description": "Servers", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Server"}}}}},
+          "default": {"$ref": "#/components/responses/error"}
+        }
+      }
+    },
+    "/servers/{id}/players": {
+      "parameters": [{"$ref": "#/components/parameters/id"}],
+      "get": {
+        "summary": "Connected players",
+        "responses": {
+          "200": {"description": "Players", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Player"}}}}},
+          "default": {"$ref": "#/components/responses/error"}
+        }
+      }
+    },
+    "/servers/{id}/game": {
+      "parameters": [{"$ref": "#/components/parameters/id"}],
+      "get": {
+        "summary": "Game state",
+        "responses": {
+          "200": {"description": "Game", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Game"}}}},
+          "default": {"$ref": "#/components/responses/error"}
+        }
+      }
+    },
+    "/servers/{id}/chat": {
+      "parameters": [
+        {"$ref": "#/components/parameters/id"},
+        {"name": "since", "in": "query", "schema": {"type": "string", "format": "date-time"}}
+      ],
+      "get": {
+        "summary": "Recent chat received after since",
+        "responses": {
+          "200": {"description": "Messages", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Message"}}}}},
+          "default": {"$ref": "#/components/responses/error"}
+        }
+      }
+    },
+    "/servers/{id}/bans": {
+      "parameters": [{"$ref": "#/components/parameters/id"}],
+      "get": {
+        "summary": "Ban list keyed by nucleus id",
+        "responses": {
+          "200": {"description": "Bans", "content": {"application/json": {"schema": {"type": "object", "additionalProperties": {"$ref": "#/components/schemas/Ban"}}}}},
+          "default": {"$ref": "#/components/responses/error"}
+        }
+      },
+      "post": {
+        "summary": "Import a ban list in the format returned by get, replacing bans with the same id",
+        "requestBody": {"content": {"application/json": {"schema": {"type": "object", "additionalProperties": {"$ref": "#/components/schemas/Ban"}}}}},
+        "responses": {"200": {"$ref": "#/components/responses/ok"}, "default": {"$ref": "#/components/responses/error"}}
+      }
+    },
+    "/servers/{id}/clans": {
+      "parameters": [{"$ref": "#/components/parameters/id"}],
+      "get": {
+        "summary": "Clan members & totals, recent round scoreboards and match reports",
+        "responses": {
+          "200": {"description": "Clan stats", "content": {"application/json": {"schema": {"type": "object"}}}},
+          "default": {"$ref": "#/components/responses/error"}
+        }
+      }
+    },
+    "/servers/{id}/match": {
+      "parameters": [{"$ref": "#/components/parameters/id"}],
+      "get": {
+        "summary": "The running match: sides, phase, rounds played & players ready; null when none",
+        "responses": {
+          "200": {"description": "Match", "content": {"application/json": {"schema": {"type": "object", "nullable": true}}}},
+          "default": {"$ref": "#/components/responses/error"}
+        }
+      }
+    },
+    "/servers/{id}/whois": {
+      "parameters": [
+        {"$ref": "#/components/parameters/id"},
+        {"name": "q", "in": "query", "required": true, "description": "nucleus id, profile id or part of any name used", "schema": {"type": "string"}}
+      ],
+      "get": {
+        "summary": "Identities & the names they used, most recently seen first",
+        "responses": {
+          "200": {"description": "Identities", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Identity"}}}}},
+          "default": {"$ref": "#/components/responses/error"}
+        }
+      }
+    },
+    "/servers/{id}/archive": {
+      "parameters": [
+        {"$ref": "#/components/parameters/id"},
+        {"name": "text", "in": "query", "description": "case insensitive text search", "schema": {"type": "string"}},
+        {"name": "player", "in": "query", "description": "name substring or nucleus id", "schema": {"type": "string"}},
+        {"name": "type", "in": "query", "description": "comma separated event types", "schema": {"type": "string"}},
+        {"name": "from", "in": "query", "schema": {"type": "string", "format": "date-time"}},
+        {"name": "to", "in": "query", "schema": {"type": "string", "format": "date-time"}},
+        {"name": "limit", "in": "query", "description": "most recent records returned", "schema": {"type": "integer"}},
+        {"name": "format", "in": "query", "schema": {"type": "string", "enum": ["json", "csv"]}}
+      ],
+      "get": {
+        "summary": "Search the chat & event archive",
+        "responses": {
+          "200": {
+            "description": "Records, oldest first",
+            "content": {
+              "application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Record"}}},
+              "text/csv": {"schema": {"type": "string"}}
+            }
+          },
+          "default": {"$ref": "#/components/responses/error"}
+        }
+      }
+    },
+    "/servers/{id}/say": {
+      "parameters": [{"$ref": "#/components/parameters/id"}],
+      "post": {
+        "summary": "Send server chat (Text)",
+        "requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Action"}}}},
+        "responses": {"200": {"$ref": "#/components/responses/ok"}, "default": {"$ref": "#/components/responses/error"}}
+      }
+    },
+    "/servers/{id}/kick": {
+      "parameters": [{"$ref": "#/components/parameters/id"}],
+      "post": {
+        "summary": "Kick a player (Pid, Name, Reason)",
+        "requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Action"}}}},
+        "responses": {"200": {"$ref": "#/components/responses/ok"}, "default": {"$ref": "#/components/responses/error"}}
+      }
+    },
+    "/servers/{id}/ban": {
+      "parameters": [{"$ref": "#/components/parameters/id"}],
+      "post": {
+        "summary": "Ban a player (Pid, Name, Reason, Duration)",
+        "requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Action"}}}},
+        "responses": {"200": {"$ref": "#/components/responses/ok"}, "default": {"$ref": "#/components/responses/error"}}
+      }
+    },
+    "/servers/{id}/relay": {
+      "parameters": [{"$ref": "#/components/parameters/id"}],
+      "post": {
+        "summary": "Bring a message (Name, Text) from the chat relay's external channel into the game",
+        "requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Action"}}}},
+        "responses": {"200": {"$ref": "#/components/responses/ok"}, "default": {"$ref": "#/components/responses/error"}}
+      }
+    },
+    "/servers/{id}/map": {
+      "parameters": [{"$ref": "#/components/parameters/id"}],
+      "post": {
+        "summary": "Change to a map list Index",
+        "requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Action"}}}},
+        "responses": {"200": {"$ref": "#/components/responses/ok"}, "default": {"$ref": "#/components/responses/error"}}
+      }
+    }
+  }
+}
+`
@@ -0,0 +1,364 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/cmd/gorcon-track (lee8oi)
+
+*/
+
+/*
+gorcon-track runs one or more Trackers and the log web server as a daemon.
+
+Usage:
+
+	gorcon-track -c /etc/gorcon/track.json
+
+The config file:
+
+	{
+		"Listen": ":23456",
+		"PidFile": "/run/gorcon-track.pid",
+		"HealthFile": "/run/gorcon-track.health",
+		"Users": "/etc/gorcon/users.json",
+		"Audit": "/var/log/gorcon/audit.log",
+		"Servers": [
+			{
+				"ID": "main",
+				"Dir": "/var/lib/gorcon/main",
+				"Interval": "500ms",
+				"Reconnect": "30s",
+				"Admin": "Gorcon",
+				"Address": "123.123.123.123",
+				"Port": "18666",
+				"Pass": "SeCrEtPaSsWoRd"
+			}
+		]
+	}
+
+The admin panel is served at /admin/ on the Listen address. Add users with
+
+	gorcon-track -c /etc/gorcon/track.json -adduser NAME
+
+and create access tokens for scripts with -token NAME. Tokens authenticate the
+JSON API served at /api/ (see the api package; /api/openapi.json describes it).
+
+Prometheus metrics are served at /metrics, or on their own address when Metrics is
+set (e.g. "Metrics": "127.0.0.1:9150").
+
+Each server keeps its data files in its own Dir. SIGTERM or SIGINT saves state and
+stops all Trackers. SIGHUP reloads every Tracker's configuration files (changes to
+the server list need a restart). The health file is rewritten every HealthEvery
+with the state of each server.
+
+The log page, admin panel & API share the Listen address. Set TLSCert & TLSKey to
+serve them over https, and Origins to let pages from other sites open the log
+websocket.
+
+Output is written to stdout with syslog priority prefixes ("<6>") so journald
+records the right level. A systemd unit might look like:
+
+	[Service]
+	ExecStart=/usr/local/bin/gorcon-track -c /etc/gorcon/track.json
+	ExecReload=/bin/kill -HUP $MAINPID
+	Restart=on-failure
+*/
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/lee8oi/gorcon"
+	"github.com/lee8oi/gorcon/admin"
+	"github.com/lee8oi/gorcon/api"
+	"github.com/lee8oi/gorcon/log"
+	"github.com/lee8oi/gorcon/metrics"
+	"github.com/lee8oi/gorcon/track"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type server struct {
+	gorcon.Config
+	ID, Dir, Interval, Reconnect string
+}
+
+type config struct {
+	Listen, PidFile, HealthFile, HealthEvery string
+	Users, Audit, TLSCert, TLSKey, Metrics   string
+	Origins                                  []string
+	Servers                                  []server
+}
+
+//health is written to the health file.
+type health struct {
+	Pid     int
+	Started time.Time
+	Updated time.Time
+	Servers map[string]serverHealth
+}
+
+type serverHealth struct {
+	Status   string
+	Received time.Time
+	Players  int
+}
+
+var (
+	configFile = flag.String("c", "gorcon-track.json", "config file")
+	addUser    = flag.String("adduser", "", "add or update an admin panel user (password read from stdin) and exit")
+	newToken   = flag.String("token", "", "create an admin panel access token for a user and exit")
+)
+
+//stopWait is how long shutdown waits for the Trackers to stop.
+const stopWait = 10 * time.Second
+
+func main() {
+	flag.Parse()
+	var c config
+	b, err := ioutil.ReadFile(*configFile)
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	if err != nil {
+		logf(3, "config: %s", err)
+		os.Exit(1)
+	}
+	if c.Users == "" {
+		c.Users = "users.json"
+	}
+	if c.Audit == "" {
+		c.Audit = "audit.log"
+	}
+	if *addUser != "" || *newToken != "" {
+		os.Exit(users(c.Users))
+	}
+	if len(c.Servers) == 0 {
+		logf(3, "config: no servers")
+		os.Exit(1)
+	}
+	every, err := time.ParseDuration(c.HealthEvery)
+	if err != nil {
+		every = 30 * time.Second
+	}
+	if c.PidFile != "" {
+		if err := ioutil.WriteFile(c.PidFile, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644); err != nil {
+			logf(3, "pid file: %s", err)
+			os.Exit(1)
+		}
+		defer os.Remove(c.PidFile)
+	}
+	mux := http.NewServeMux()
+	web, err := log.New(log.Options{
+		Addr:     c.Listen,
+		Mux:      mux,
+		CertFile: c.TLSCert,
+		KeyFile:  c.TLSKey,
+		Origins:  c.Origins,
+	})
+	if err != nil {
+		logf(3, "%s", err)
+		os.Exit(1)
+	}
+	track.Log = func(s string) {
+		web.Log(s)
+		logf(6, "%s", strings.TrimSpace(s))
+	}
+	track.Publish = func(m log.Message) {
+		web.Publish(m)
+		if m.Text != "" {
+			logf(6, "[%s] %s", m.Server, strings.TrimSpace(m.Text))
+		}
+	}
+	trackers := make(map[string]*track.Tracker)
+	for _, s := range c.Servers {
+		t := &track.Tracker{ID: s.ID, Dir: s.Dir}
+		trackers[s.ID] = t
+		go run(t, s)
+	}
+	panel := admin.New(trackers, c.Users, c.Audit)
+	panel.Register(mux)
+	api.New(trackers, func(token string) (string, bool) {
+		return admin.CheckToken(c.Users, token)
+	}, panel.Record).Register(mux)
+	failed := make(chan error, 1)
+	if c.Metrics == "" {
+		metrics.New(trackers, web).Register(mux)
+	} else {
+		go func() {
+			failed <- http.ListenAndServe(c.Metrics, metrics.New(trackers, web))
+		}()
+	}
+	go func() {
+		if err := web.ListenAndServe(); err != http.ErrServerClosed {
+			failed <- err
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	started := time.Now()
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	done := make(chan struct{})
+	if c.HealthFile != "" { //written apart from signal handling, so a stuck Tracker can't block it
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				case <-tick.C:
+					writeHealth(c.HealthFile, started, trackers)
+				}
+			}
+		}()
+	}
+	code := 0
+loop:
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				logf(5, "reloading")
+				for _, t := range trackers {
+					go t.Reload()
+				}
+				continue
+			}
+			logf(5, "%s: shutting down", sig)
+			break loop
+		case err := <-failed:
+			logf(3, "listen: %s", err)
+			code = 1
+			break loop
+		}
+	}
+	close(done)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := web.Shutdown(ctx); err != nil {
+		logf(4, "shutdown: %s", err)
+	}
+	cancel()
+	var wg sync.WaitGroup
+	for _, t := range trackers {
+		wg.Add(1)
+		go func(t *track.Tracker) {
+			defer wg.Done()
+			t.Stop()
+		}(t)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(stopWait):
+		logf(4, "shutdown: trackers did not stop within %s", stopWait)
+	}
+	if c.HealthFile != "" {
+		os.Remove(c.HealthFile)
+	}
+	logf(5, "stopped")
+	if code != 0 {
+		if c.PidFile != "" {
+			os.Remove(c.PidFile)
+		}
+		os.Exit(code)
+	}
+}
+
+//users handles the -adduser & -token flags.
+func users(path string) int {
+	if *addUser != "" {
+		fmt.Fprint(os.Stderr, "password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err == nil {
+			err = admin.SetPassword(path, *addUser, strings.TrimSpace(line))
+		}
+		if err != nil {
+			logf(3, "%s", err)
+			return 1
+		}
+	}
+	if *newToken != "" {
+		token, err := admin.NewToken(path, *newToken)
+		if err != nil {
+			logf(3, "%s", err)
+			return 1
+		}
+		fmt.Println(token)
+	}
+	return 0
+}
+
+//run connects & logs in to a server, retrying until it succeeds, then runs the
+//Tracker.
+func run(t *track.Tracker, s server) {
+	if s.Interval == "" {
+		s.Interval = "500ms"
+	}
+	if s.Reconnect == "" {
+		s.Reconnect = "30s"
+	}
+	wait, err := time.ParseDuration(s.Reconnect)
+	if err != nil {
+		logf(3, "%s: reconnect: %s", s.ID, err)
+		return
+	}
+	for {
+		err := t.Rcon.Connect(s.Address + ":" + s.Port)
+		if err == nil {
+			if err = t.Rcon.Login(s.Admin, s.Pass); err == gorcon.ErrAuth {
+				logf(3, "%s: %s", s.ID, err)
+				return
+			}
+		}
+		if err == nil {
+			break
+		}
+		logf(4, "%s: %s, retrying in %s", s.ID, err, wait)
+		time.Sleep(wait)
+	}
+	logf(6, "%s: connected to %s:%s", s.ID, s.Address, s.Port)
+	t.Rcon.AutoReconnect(s.Reconnect)
+	t.Start(s.Interval)
+}
+
+//writeHealth writes the state of every Tracker to path as JSON.
+func writeHealth(path string, started time.Time, trackers map[string]*track.Tracker) {
+	h := health{
+		Pid:     os.Getpid(),
+		Started: started,
+		Updated: time.Now(),
+		Servers: make(map[string]serverHealth),
+	}
+	for id, t := range trackers {
+		var sh serverHealth
+		sh.Status, sh.Received, sh.Players = t.Health()
+		h.Servers[id] = sh
+	}
+	b, err := json.MarshalIndent(h, "", "    ")
+	if err == nil {
+		err = ioutil.WriteFile(path, b, 0644)
+	}
+	if err != nil {
+		logf(4, "health file: %s", err)
+	}
+}
+
+//logf prints a line to stdout with a syslog priority prefix understood by journald
+//(3 error, 4 warning, 5 notice, 6 info).
+func logf(priority int, format string, a ...interface{}) {
+	fmt.Printf("<%d>%s\n", priority, fmt.Sprintf(format, a...))
+}
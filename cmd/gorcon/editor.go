@@ -0,0 +1,225 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/cmd/gorcon (lee8oi)
+
+editor is a small readline style line editor with history & tab completion.
+*/
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+//completions are the commands offered by tab completion.
+var completions = []string{
+	"bf2cc si",
+	"bf2cc pl",
+	"bf2cc clientchatbuffer",
+	"bf2cc serverchatbuffer",
+	"bf2cc sendserverchat ",
+	"bf2cc setadminname ",
+	"bf2cc monitor 0",
+	"bf2cc monitor 1",
+	"exec admin.kickPlayer ",
+	"exec admin.listPlayers",
+	"exec admin.currentLevel",
+	"exec admin.nextLevel",
+	"exec admin.restartMap",
+	"exec admin.runNextLevel",
+	"exec game.sayToPlayerWithId ",
+	"exec game.setPersonaVipStatus ",
+	"exec maplist.list",
+	"exec maplist.configFile",
+	"exec sv.serverName",
+	"quit",
+}
+
+//maxHistory is the number of lines kept in the history file.
+const maxHistory = 500
+
+//errEOF is returned by readLine when the user presses ctrl-D on an empty line.
+var errEOF = errors.New("EOF")
+
+type editor struct {
+	prompt  string
+	path    string
+	history []string
+	words   []string
+	in      *bufio.Reader
+	out     io.Writer
+	restore func()
+}
+
+//newEditor puts the terminal in raw mode & loads history from path. Returns an
+//error if stdin is not a terminal.
+func newEditor(prompt, path string, words []string) (*editor, error) {
+	restore, err := rawMode(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	e := &editor{
+		prompt:  prompt,
+		path:    path,
+		words:   words,
+		in:      bufio.NewReader(os.Stdin),
+		out:     os.Stdout,
+		restore: restore,
+	}
+	if b, err := ioutil.ReadFile(path); err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			if line != "" {
+				e.history = append(e.history, line)
+			}
+		}
+	}
+	return e, nil
+}
+
+//close restores the terminal & saves the history.
+func (e *editor) close() {
+	e.restore()
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+	ioutil.WriteFile(e.path, []byte(strings.Join(e.history, "\n")+"\n"), 0600)
+}
+
+//redraw prints the prompt & buf with the cursor at pos.
+func (e *editor) redraw(buf []rune, pos int) {
+	fmt.Fprintf(e.out, "\r\033[K%s%s", e.prompt, string(buf))
+	if back := len(buf) - pos; back > 0 {
+		fmt.Fprintf(e.out, "\033[%dD", back)
+	}
+}
+
+//println prints s on its own line while in raw mode.
+func (e *editor) println(s string) {
+	fmt.Fprint(e.out, "\r\n"+strings.Replace(s, "\n", "\r\n", -1)+"\r\n")
+}
+
+//readLine reads a line of input.
+func (e *editor) readLine() (string, error) {
+	var buf []rune
+	pos := 0
+	index := len(e.history) //history position, len(history) is the new line
+	e.redraw(buf, pos)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			line := string(buf)
+			if strings.TrimSpace(line) != "" && (len(e.history) == 0 || e.history[len(e.history)-1] != line) {
+				e.history = append(e.history, line)
+			}
+			return line, nil
+		case 3: //ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			buf, pos = nil, 0
+		case 4: //ctrl-D
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", errEOF
+			}
+		case 1: //ctrl-A
+			pos = 0
+		case 5: //ctrl-E
+			pos = len(buf)
+		case 21: //ctrl-U
+			buf, pos = buf[pos:], 0
+		case 127, 8: //backspace
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case '\t':
+			buf = e.complete(buf)
+			pos = len(buf)
+		case 27: //escape sequences
+			if b, _ := e.in.ReadByte(); b != '[' {
+				continue
+			}
+			b, _ := e.in.ReadByte()
+			switch b {
+			case 'A': //up
+				if index > 0 {
+					index--
+					buf = []rune(e.history[index])
+					pos = len(buf)
+				}
+			case 'B': //down
+				if index < len(e.history) {
+					index++
+					buf = nil
+					if index < len(e.history) {
+						buf = []rune(e.history[index])
+					}
+					pos = len(buf)
+				}
+			case 'C': //right
+				if pos < len(buf) {
+					pos++
+				}
+			case 'D': //left
+				if pos > 0 {
+					pos--
+				}
+			case 'H':
+				pos = 0
+			case 'F':
+				pos = len(buf)
+			case '3': //delete
+				e.in.ReadByte() // '~'
+				if pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+				}
+			}
+		default:
+			if r >= 32 {
+				buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+				pos++
+			}
+		}
+		e.redraw(buf, pos)
+	}
+}
+
+//complete extends buf to the longest common prefix of the matching completions.
+//When that adds nothing the matches are listed.
+func (e *editor) complete(buf []rune) []rune {
+	line := string(buf)
+	var matches []string
+	for _, w := range e.words {
+		if strings.HasPrefix(w, line) {
+			matches = append(matches, w)
+		}
+	}
+	if len(matches) == 0 {
+		return buf
+	}
+	prefix := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if len(matches) > 1 && prefix == line {
+		sort.Strings(matches)
+		e.println(strings.Join(matches, "\n"))
+	}
+	return []rune(prefix)
+}
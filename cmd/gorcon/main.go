@@ -0,0 +1,203 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/cmd/gorcon (lee8oi)
+
+*/
+
+/*
+gorcon is an interactive console for BF2CC based Rcon servers.
+
+Usage:
+
+	gorcon [flags] [command ...]
+
+With no commands gorcon starts an interactive console with history (up/down) and
+tab completion of bf2cc & exec commands. Given commands, gorcon runs each one,
+prints the results and exits:
+
+	gorcon -p prod "bf2cc si"
+
+Connection profiles are read from ~/.gorcon.json:
+
+	{
+		"prod": {"Admin": "Gorcon", "Address": "123.123.123.123", "Port": "18666", "Pass": "SeCrEt"}
+	}
+
+Exit codes: 0 success, 1 usage or profile error, 2 connection error,
+3 authentication failed, 4 command failed.
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/lee8oi/gorcon"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	exitOK = iota
+	exitUsage
+	exitConnect
+	exitAuth
+	exitCommand
+)
+
+var (
+	profiles = flag.String("f", filepath.Join(home(), ".gorcon.json"), "connection profiles file")
+	profile  = flag.String("p", "default", "connection profile")
+	address  = flag.String("a", "", "server address (overrides profile)")
+	port     = flag.String("port", "", "rcon port (overrides profile)")
+	admin    = flag.String("u", "", "admin name (overrides profile)")
+	pass     = flag.String("pass", "", "rcon password (overrides profile)")
+	raw      = flag.Bool("raw", false, "print responses as received, without tables")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gorcon [flags] [command ...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	os.Exit(run(flag.Args()))
+}
+
+func run(commands []string) int {
+	config, err := loadProfile(*profiles, *profile)
+	if err != nil && *address == "" {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	override(&config.Address, *address)
+	override(&config.Port, *port)
+	override(&config.Admin, *admin)
+	override(&config.Pass, *pass)
+	var r gorcon.Rcon
+	stdout := os.Stdout
+	os.Stdout = os.Stderr //keep connection chatter out of command output
+	err = r.Connect(config.Address + ":" + config.Port)
+	if err == nil {
+		defer r.Close()
+		err = r.Login(config.Admin, config.Pass)
+	}
+	os.Stdout = stdout
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if err == gorcon.ErrAuth {
+			return exitAuth
+		}
+		return exitConnect
+	}
+	if len(commands) > 0 {
+		for _, c := range commands {
+			result, err := r.Send(c)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitCommand
+			}
+			show(os.Stdout, result)
+		}
+		return exitOK
+	}
+	return console(&r)
+}
+
+//console runs the interactive prompt until EOF or 'quit'.
+func console(r *gorcon.Rcon) int {
+	hist := filepath.Join(home(), ".gorcon_history")
+	e, err := newEditor("rcon> ", hist, completions)
+	if err != nil { //not a terminal, read plain lines
+		in := bufio.NewScanner(os.Stdin)
+		for in.Scan() {
+			if code := do(r, in.Text()); code >= 0 {
+				return code
+			}
+		}
+		return exitOK
+	}
+	defer e.close()
+	for {
+		line, err := e.readLine()
+		if err != nil {
+			return exitOK
+		}
+		if code := do(r, line); code >= 0 {
+			return code
+		}
+	}
+}
+
+//do runs a single console line. Returns an exit code to stop the console or -1 to
+//carry on.
+func do(r *gorcon.Rcon, line string) int {
+	line = strings.TrimSpace(line)
+	switch line {
+	case "":
+		return -1
+	case "quit", "exit":
+		return exitOK
+	}
+	result, err := r.Send(line)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCommand
+	}
+	show(os.Stdout, result)
+	return -1
+}
+
+//show prints a response. Tab separated responses are lined up as a table.
+func show(f *os.File, result string) {
+	result = strings.Replace(result, "\r\n", "\n", -1)
+	result = strings.Replace(result, "\r", "\n", -1)
+	if *raw || !strings.Contains(result, "\t") {
+		fmt.Fprintln(f, result)
+		return
+	}
+	w := tabwriter.NewWriter(f, 0, 4, 2, ' ', 0)
+	for _, line := range strings.Split(result, "\n") {
+		fmt.Fprintln(w, strings.TrimRight(line, "\t")+"\t")
+	}
+	w.Flush()
+}
+
+//loadProfile returns the named connection profile.
+func loadProfile(path, name string) (config gorcon.Config, err error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var list map[string]gorcon.Config
+	if err = json.Unmarshal(b, &list); err != nil {
+		return
+	}
+	config, ok := list[name]
+	if !ok {
+		err = fmt.Errorf("no profile '%s' in %s", name, path)
+	}
+	return
+}
+
+//override sets *field to value unless value is empty.
+func override(field *string, value string) {
+	if value != "" {
+		*field = value
+	}
+}
+
+//home returns the user's home directory.
+func home() string {
+	if h := os.Getenv("HOME"); h != "" {
+		return h
+	}
+	return os.Getenv("USERPROFILE")
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/cmd/gorcon (lee8oi)
+
+*/
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+//rawMode is not supported on this platform. The console falls back to plain line
+//input without history or completion.
+func rawMode(f *os.File) (func(), error) {
+	return nil, errors.New("raw terminal mode not supported")
+}
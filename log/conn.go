@@ -14,8 +14,13 @@ http://gary.beagledreams.com/page/go-websocket-chat.html
 package log
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/gorilla/websocket"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type connection struct {
@@ -24,15 +29,60 @@ type connection struct {
 
 	// Buffered channel of outbound messages.
 	send chan []byte
+
+	// Send JSON envelopes instead of plain text.
+	json bool
+
+	// Subscribed topics & servers, nil for all.
+	topics, servers map[string]bool
+
+	// ID of the last message the client saw & the number it has missed since.
+	since, dropped uint64
+}
+
+//notice returns the "dropped N messages" notice for the connection.
+func (c *connection) notice() []byte {
+	if !c.json {
+		return []byte(fmt.Sprintf("*** dropped %d messages ***\n", c.dropped))
+	}
+	b, _ := json.Marshal(Message{
+		Type:      "dropped",
+		Timestamp: time.Now(),
+		Payload:   map[string]uint64{"count": c.dropped},
+	})
+	return b
 }
 
+//wants returns true if the connection subscribed to the message's type and server.
+func (c *connection) wants(m Message) bool {
+	if c.topics != nil && !c.topics[m.Type] {
+		return false
+	}
+	if c.servers != nil && m.Server != "" && !c.servers[m.Server] {
+		return false
+	}
+	return true
+}
+
+//set turns a comma separated list into a set, nil when the list is empty.
+func set(list string) map[string]bool {
+	if list == "" {
+		return nil
+	}
+	s := make(map[string]bool)
+	for _, v := range strings.Split(list, ",") {
+		s[strings.TrimSpace(v)] = true
+	}
+	return s
+}
+
+//reader reads until the connection closes. Messages from browsers are dropped, the
+//log is read-only.
 func (c *connection) reader() {
 	for {
-		_, message, err := c.ws.ReadMessage()
-		if err != nil {
+		if _, _, err := c.ws.ReadMessage(); err != nil {
 			break
 		}
-		H.broadcast <- message
 	}
 	c.ws.Close()
 }
@@ -47,7 +97,11 @@ func (c *connection) writer() {
 	c.ws.Close()
 }
 
-func wsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) wsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.allowed(r) {
+		http.Error(w, "Origin not allowed", 403)
+		return
+	}
 	ws, err := websocket.Upgrade(w, r, nil, 1024, 1024)
 	if _, ok := err.(websocket.HandshakeError); ok {
 		http.Error(w, "Not a websocket handshake", 400)
@@ -55,9 +109,28 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 	} else if err != nil {
 		return
 	}
-	c := &connection{send: make(chan []byte, 256), ws: ws}
-	H.register <- c
-	defer func() { H.unregister <- c }()
+	q := r.URL.Query()
+	since, _ := strconv.ParseUint(q.Get("since"), 10, 64)
+	c := &connection{
+		send:    make(chan []byte, 256),
+		ws:      ws,
+		json:    q.Get("format") == "json",
+		topics:  set(q.Get("topics")),
+		servers: set(q.Get("servers")),
+		since:   since,
+	}
+	select {
+	case s.hub.register <- c:
+	case <-s.hub.done:
+		ws.Close()
+		return
+	}
+	defer func() {
+		select {
+		case s.hub.unregister <- c:
+		case <-s.hub.done:
+		}
+	}()
 	go c.writer()
 	c.reader()
 }
@@ -14,55 +14,190 @@ http://gary.beagledreams.com/page/go-websocket-chat.html
 package log
 
 import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+/*
+Message is the envelope sent to websocket clients. Type is the topic ("log", "chat",
+"player", "game" or "moderation"), Server the ID of the Tracker that produced it.
+
+ID is set by the hub when the message is published, clients pass the last ID they
+saw as ?since= when reconnecting. Clients in the legacy text mode receive only Text,
+messages without Text are not sent to them.
+*/
+type Message struct {
+	ID        uint64      `json:"id,omitempty"`
+	Type      string      `json:"type"`
+	Server    string      `json:"server,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	Payload   interface{} `json:"payload"`
+	Text      string      `json:"-"`
+}
+
+//history is the number of recent messages kept for replay to new sockets.
+const history = 200
+
+//entry is a message kept in the history.
+type entry struct {
+	m    Message
+	data []byte //JSON encoding, made on first use
+}
+
+//bytes returns what is sent to a socket in JSON or text mode.
+func (e *entry) bytes(asJSON bool) []byte {
+	if !asJSON {
+		return []byte(e.m.Text)
+	}
+	if e.data == nil {
+		var err error
+		if e.data, err = json.Marshal(e.m); err != nil {
+			e.data = []byte{}
+		}
+	}
+	return e.data
+}
+
 type hub struct {
 	// Registered connections.
 	connections map[*connection]bool
 
 	// Inbound messages from the connections.
-	broadcast chan []byte
+	broadcast chan Message
 
 	// Register requests from the connections.
 	register chan *connection
 
 	// Unregister requests from connections.
 	unregister chan *connection
+
+	// Ring buffer of recent messages indexed by ID % history, & the last ID used.
+	ring [history]*entry
+	seq  uint64
+
+	// Number of registered connections, readable from other goroutines.
+	clients int64
+
+	// Closed to stop the hub, & by the hub once it has stopped.
+	quit, done chan struct{}
+	once       sync.Once
 }
 
-var H = hub{
-	broadcast:   make(chan []byte),
-	register:    make(chan *connection),
-	unregister:  make(chan *connection),
-	connections: make(map[*connection]bool),
+func newHub() *hub {
+	return &hub{
+		broadcast:   make(chan Message),
+		register:    make(chan *connection),
+		unregister:  make(chan *connection),
+		connections: make(map[*connection]bool),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
 }
 
 func (h *hub) run() {
+	defer close(h.done)
 	for {
 		select {
+		case <-h.quit:
+			for c := range h.connections {
+				delete(h.connections, c)
+				close(c.send)
+			}
+			atomic.StoreInt64(&h.clients, 0)
+			return
 		case c := <-h.register:
 			h.connections[c] = true
+			atomic.StoreInt64(&h.clients, int64(len(h.connections)))
+			h.replay(c)
 		case c := <-h.unregister:
 			delete(h.connections, c)
 			close(c.send)
+			atomic.StoreInt64(&h.clients, int64(len(h.connections)))
 		case m := <-h.broadcast:
+			h.seq++
+			m.ID = h.seq
+			e := &entry{m: m}
+			h.ring[h.seq%history] = e
 			for c := range h.connections {
-				select {
-				case c.send <- m:
-				default:
-					delete(h.connections, c)
-					close(c.send)
-					go c.ws.Close()
-				}
+				h.deliver(c, e)
 			}
 		}
 	}
 }
 
+//replay sends a new connection the history after its cursor. Messages that already
+//left the history are reported as dropped.
+func (h *hub) replay(c *connection) {
+	if c.since > h.seq { //cursor from before a restart
+		c.since = 0
+	}
+	oldest := uint64(1)
+	if h.seq > history {
+		oldest = h.seq - history + 1
+	}
+	if c.since+1 < oldest {
+		if c.since > 0 {
+			c.dropped += oldest - 1 - c.since
+		}
+		c.since = oldest - 1
+	}
+	for id := c.since + 1; id <= h.seq; id++ {
+		h.deliver(c, h.ring[id%history])
+	}
+}
+
+/*
+deliver queues e on the connection if it is subscribed. A connection whose buffer is
+full misses the message and is sent a "dropped" notice once it catches up, rather
+than being disconnected.
+*/
+func (h *hub) deliver(c *connection, e *entry) {
+	if !c.wants(e.m) {
+		return
+	}
+	b := e.bytes(c.json)
+	if len(b) == 0 {
+		return
+	}
+	if c.dropped > 0 {
+		select {
+		case c.send <- c.notice():
+			c.dropped = 0
+		default:
+			c.dropped++
+			return
+		}
+	}
+	select {
+	case c.send <- b:
+	default:
+		c.dropped++
+	}
+}
+
 //log is an attempt to broadcast a log message to currently open sockets
 func (h *hub) Log(s string) {
-	h.broadcast <- []byte(s)
+	h.Publish(Message{Type: "log", Payload: s, Text: s})
+}
+
+//Publish broadcasts m to the open sockets subscribed to its type & server. A zero
+//Timestamp is set to the current time.
+func (h *hub) Publish(m Message) {
+	if m.Timestamp.IsZero() {
+		m.Timestamp = time.Now()
+	}
+	select {
+	case h.broadcast <- m:
+	case <-h.done:
+	}
+}
+
+//stop closes every connection & stops the hub.
+func (h *hub) stop() {
+	h.once.Do(func() { close(h.quit) })
+	<-h.done
 }
 
 //loop is used for development/testing. Simply broadcasts the current date/time.
@@ -13,34 +13,151 @@ http://gary.beagledreams.com/page/go-websocket-chat.html
 /*
 The log package is used to log messages to the web via gorilla websocket. This
 version of the package is intended to be used with gorcon.
+
+	s, err := log.New(log.Options{Addr: ":23456"})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	go s.ListenAndServe()
+	s.Log("hello\n")
 */
 package log
 
 import (
-	"flag"
-	"log"
+	"context"
+	_ "embed"
+	"errors"
+	"io/fs"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
 	"text/template"
 )
 
-var addr = flag.String("addr", ":23456", "http service address")
-var homeTempl = template.Must(template.ParseFiles("home.html"))
+//go:embed home.html
+var home string
+
+//Options configure a Server.
+type Options struct {
+	Addr string //listen address, ":23456" when empty
+
+	//Assets replaces the embedded page; it must hold a 'home.html' template which is
+	//executed with the request Host.
+	Assets fs.FS
+
+	//Mux receives the "/" & "/ws" handlers. A new ServeMux is used when nil, pass
+	//your own to serve other handlers on the same address.
+	Mux *http.ServeMux
+
+	//CertFile & KeyFile enable TLS.
+	CertFile, KeyFile string
+
+	//Origins lists the origins (e.g. "https://example.com") allowed to open a socket;
+	//"*" allows any. When empty only pages served from the request host may connect.
+	Origins []string
+}
 
-func homeHandler(c http.ResponseWriter, req *http.Request) {
-	homeTempl.Execute(c, req.Host)
+//Server serves the log page & websocket.
+type Server struct {
+	opt  Options
+	home *template.Template
+	hub  *hub
+	http *http.Server
 }
 
-//func main() {
-//	//flag.Parse()
+//New returns a Server for the options. The handlers are added to the mux but
+//nothing is served until ListenAndServe.
+func New(opt Options) (*Server, error) {
+	if opt.Addr == "" {
+		opt.Addr = ":23456"
+	}
+	if opt.Mux == nil {
+		opt.Mux = http.NewServeMux()
+	}
+	if (opt.CertFile == "") != (opt.KeyFile == "") {
+		return nil, errors.New("log: CertFile and KeyFile must be set together")
+	}
+	var (
+		t   *template.Template
+		err error
+	)
+	if opt.Assets != nil {
+		t, err = template.ParseFS(opt.Assets, "home.html")
+	} else {
+		t, err = template.New("home.html").Parse(home)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{opt: opt, home: t, hub: newHub()}
+	s.http = &http.Server{Addr: opt.Addr, Handler: opt.Mux}
+	opt.Mux.HandleFunc("/", s.homeHandler)
+	opt.Mux.HandleFunc("/ws", s.wsHandler)
+	go s.hub.run()
+	return s, nil
+}
 
-//}
+func (s *Server) homeHandler(c http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(c, req)
+		return
+	}
+	s.home.Execute(c, req.Host)
+}
 
-func Start() {
-	go H.run()
-	//go H.Loop()
-	http.HandleFunc("/", homeHandler)
-	http.HandleFunc("/ws", wsHandler)
-	if err := http.ListenAndServe(*addr, nil); err != nil {
-		log.Fatal("ListenAndServe:", err)
+//allowed returns true if the request's Origin may open a socket.
+func (s *Server) allowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true //not a browser
 	}
+	if len(s.opt.Origins) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	for _, o := range s.opt.Origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+//ListenAndServe serves until Shutdown, using TLS when a certificate is configured.
+//It returns http.ErrServerClosed after Shutdown.
+func (s *Server) ListenAndServe() error {
+	if s.opt.CertFile != "" {
+		return s.http.ListenAndServeTLS(s.opt.CertFile, s.opt.KeyFile)
+	}
+	return s.http.ListenAndServe()
+}
+
+//Shutdown stops the server, waiting for active requests until ctx is done, and
+//closes every socket. Messages published afterwards are discarded.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.http.Shutdown(ctx)
+	s.hub.stop()
+	return err
+}
+
+//Clients returns the number of open sockets.
+func (s *Server) Clients() int {
+	return int(atomic.LoadInt64(&s.hub.clients))
+}
+
+//Mux returns the ServeMux the Server's handlers are registered on.
+func (s *Server) Mux() *http.ServeMux {
+	return s.opt.Mux
+}
+
+//Log broadcasts a text message to the open sockets.
+func (s *Server) Log(text string) {
+	s.hub.Log(text)
+}
+
+//Publish broadcasts m to the open sockets subscribed to its type & server.
+func (s *Server) Publish(m Message) {
+	s.hub.Publish(m)
 }
@@ -14,12 +14,17 @@ package gorcon
 import (
 	"bufio"
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+//ErrAuth is returned by Login when the server rejects the admin password.
+var ErrAuth = errors.New("authentication failed")
+
 type Config struct {
 	Admin, Address, Port, Pass string
 }
@@ -32,6 +37,58 @@ type Rcon struct {
 	send                               chan []byte
 	queue                              chan string
 	receive                            chan string
+	sent                               chan time.Time //write times of commands awaiting a reply
+	stats                              Stats
+	ready                              int32 //set once Init has made the queue
+}
+
+//Stats are the counters kept by an Rcon connection.
+type Stats struct {
+	Queued                   int64         //commands waiting in the queue
+	Commands, Replies        int64         //commands written & replies read
+	Latency                  time.Duration //total time between commands & their replies
+	Timed                    int64         //replies paired with a command, counted in Latency
+	Reconnects, AuthFailures int64
+	BytesSent, BytesReceived int64
+}
+
+//Stats returns a snapshot of the connection counters. Latency is measured by pairing
+//each reply with the oldest unanswered command, so it is approximate.
+func (r *Rcon) Stats() Stats {
+	return Stats{
+		Queued:        atomic.LoadInt64(&r.stats.Queued),
+		Commands:      atomic.LoadInt64(&r.stats.Commands),
+		Replies:       atomic.LoadInt64(&r.stats.Replies),
+		Latency:       time.Duration(atomic.LoadInt64((*int64)(&r.stats.Latency))),
+		Timed:         atomic.LoadInt64(&r.stats.Timed),
+		Reconnects:    atomic.LoadInt64(&r.stats.Reconnects),
+		AuthFailures:  atomic.LoadInt64(&r.stats.AuthFailures),
+		BytesSent:     atomic.LoadInt64(&r.stats.BytesSent),
+		BytesReceived: atomic.LoadInt64(&r.stats.BytesReceived),
+	}
+}
+
+//sentCommand counts a command of n bytes written to the socket.
+func (r *Rcon) sentCommand(n int) {
+	atomic.AddInt64(&r.stats.Commands, 1)
+	atomic.AddInt64(&r.stats.BytesSent, int64(n))
+	select {
+	case r.sent <- time.Now():
+	default: //nil before Init, or too many unanswered
+	}
+}
+
+//gotReply counts a reply of n bytes, timing it against the oldest unanswered
+//command.
+func (r *Rcon) gotReply(n int) {
+	atomic.AddInt64(&r.stats.Replies, 1)
+	atomic.AddInt64(&r.stats.BytesReceived, int64(n))
+	select {
+	case at := <-r.sent:
+		atomic.AddInt64((*int64)(&r.stats.Latency), int64(time.Since(at)))
+		atomic.AddInt64(&r.stats.Timed, 1)
+	default:
+	}
 }
 
 //AutoReconnect enables reconnection. Valid time units are "ns", "us" (or "µs"),
@@ -56,7 +113,12 @@ func (r *Rcon) Connect(address string) (err error) {
 	}
 	r.status = "connected"
 	str := r.Scan("### Digest seed:")
-	r.seed = strings.TrimSpace(strings.Split(str, ":")[1])
+	split := strings.Split(str, ":")
+	if len(split) < 2 {
+		r.sock.Close()
+		return errors.New("no digest seed from " + address)
+	}
+	r.seed = strings.TrimSpace(split[1])
 	return
 }
 
@@ -70,7 +132,11 @@ func (r *Rcon) Login(admin, pass string) (err error) {
 	if err != nil {
 		return err
 	}
-	r.Scan("Authentication successful")
+	if str := r.Scan("Authentication"); !strings.Contains(str, "successful") {
+		r.status = "error"
+		atomic.AddInt64(&r.stats.AuthFailures, 1)
+		return ErrAuth
+	}
 	if len(r.admin) > 0 {
 		r.Send(fmt.Sprintf("bf2cc setadminname %s", r.admin))
 	}
@@ -78,6 +144,22 @@ func (r *Rcon) Login(admin, pass string) (err error) {
 	return
 }
 
+//Close closes the Rcon connection and disables reconnection.
+func (r *Rcon) Close() error {
+	r.reconnect = false
+	r.status = "closed"
+	if r.sock == nil {
+		return nil
+	}
+	return r.sock.Close()
+}
+
+//Status returns the connection status: "connected", "authenticated", "reconnecting",
+//"error" or "closed" ("" before Connect).
+func (r *Rcon) Status() string {
+	return r.status
+}
+
 //Reconnect attempts to re-establish Rcon connection. Waiting duration & trying
 //again on failure.
 func (r *Rcon) Reconnect() error {
@@ -93,6 +175,7 @@ func (r *Rcon) Reconnect() error {
 			return err
 		}
 		fmt.Println("Reconnection successful.")
+		atomic.AddInt64(&r.stats.Reconnects, 1)
 		break
 	}
 	return nil
@@ -118,6 +201,7 @@ func (r *Rcon) Scan(str string) (s string) {
 //Includes reconnection on connect errors.
 func (r *Rcon) Send(command string) (string, error) {
 	line := "\u0002" + command + "\n"
+	start := time.Now()
 	_, err := r.sock.Write([]byte(line))
 	if err != nil {
 		fmt.Println("Write/connection issue:", err)
@@ -129,7 +213,12 @@ func (r *Rcon) Send(command string) (string, error) {
 			}
 		}
 	}
+	atomic.AddInt64(&r.stats.Commands, 1)
+	atomic.AddInt64(&r.stats.BytesSent, int64(len(line)))
 	result, err := bufio.NewReader(r.sock).ReadString('\u0004')
+	atomic.AddInt64(&r.stats.Replies, 1)
+	atomic.AddInt64(&r.stats.BytesReceived, int64(len(result)))
+	atomic.AddInt64((*int64)(&r.stats.Latency), int64(time.Since(start)))
 	if err != nil {
 		fmt.Println("Reader/connection issue:", err)
 		if strings.Contains(fmt.Sprintf("%s", err), "connect") && r.reconnect {
@@ -149,12 +238,18 @@ func (r *Rcon) Reader() {
 	for {
 		result, err := bufio.NewReader(r.sock).ReadString('\u0004')
 		if err != nil {
+			if r.status == "closed" {
+				return
+			}
 			fmt.Println(err)
 			r.status = "error"
 			if strings.Contains(fmt.Sprintf("%s", err), "connect") && r.reconnect {
 				r.Reconnect()
 			}
 		}
+		if len(result) > 0 {
+			r.gotReply(len(result))
+		}
 		result = strings.TrimSpace(strings.Trim(result, "\u0004"))
 		if len(result) > 0 {
 			//fmt.Println(result)
@@ -176,7 +271,9 @@ func (r *Rcon) Writer() {
 		if err != nil {
 			fmt.Println(err)
 			r.status = "error"
+			continue
 		}
+		r.sentCommand(len(line))
 	}
 }
 
@@ -193,16 +290,25 @@ func (r *Rcon) Write(message string) {
 func (r *Rcon) Init() {
 	r.queue = make(chan string)
 	r.receive = make(chan string)
+	r.sent = make(chan time.Time, 64)
+	atomic.StoreInt32(&r.ready, 1)
 	go r.Reader()
 	go r.Writer()
 	r.Queue(100 * time.Millisecond)
 }
 
+//Ready reports whether the connection is authenticated & Init has run, so Enqueue
+//won't wait.
+func (r *Rcon) Ready() bool {
+	return atomic.LoadInt32(&r.ready) == 1 && r.status == "authenticated"
+}
+
 //Enqueue adds a command line to the Queue to be written to the Rcon connection via Writer.
 func (r *Rcon) Enqueue(line string) {
-	for r.queue == nil { //wait to queue if channel is not available
+	for atomic.LoadInt32(&r.ready) == 0 { //wait to queue if channel is not available
 		time.Sleep(1 * time.Second)
 	}
+	atomic.AddInt64(&r.stats.Queued, 1)
 	r.queue <- line
 }
 
@@ -211,6 +317,7 @@ func (r *Rcon) Enqueue(line string) {
 func (r *Rcon) Queue(dur time.Duration) {
 	for s := range r.queue {
 		r.Write(s)
+		atomic.AddInt64(&r.stats.Queued, -1)
 		time.Sleep(dur)
 	}
 }
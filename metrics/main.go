@@ -0,0 +1,151 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/metrics (lee8oi)
+
+*/
+
+/*
+The metrics package exports Tracker, Rcon & log server figures in the Prometheus
+text format. Add it to the log server's mux:
+
+	metrics.New(trackers, web).Register(web.Mux())
+
+or serve it on its own address:
+
+	go http.ListenAndServe(":9150", metrics.New(trackers, nil))
+*/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/lee8oi/gorcon/log"
+	"github.com/lee8oi/gorcon/track"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Metrics serves the /metrics page.
+type Metrics struct {
+	trackers map[string]*track.Tracker
+	web      *log.Server
+}
+
+//New returns Metrics for the trackers (keyed by Tracker.ID) & web, which may be nil.
+func New(trackers map[string]*track.Tracker, web *log.Server) *Metrics {
+	return &Metrics{trackers: trackers, web: web}
+}
+
+//Register adds the /metrics handler to mux.
+func (m *Metrics) Register(mux *http.ServeMux) {
+	mux.Handle("/metrics", m)
+}
+
+//metric is one exported family.
+type metric struct {
+	name, kind, help string
+	samples          []sample
+}
+
+type sample struct {
+	labels string
+	value  float64
+}
+
+func (m *metric) add(value float64, labels ...string) {
+	var l []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		l = append(l, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	s := sample{value: value}
+	if len(l) > 0 {
+		s.labels = "{" + strings.Join(l, ",") + "}"
+	}
+	m.samples = append(m.samples, s)
+}
+
+//number parses a game value, 0 when it is missing.
+func number(s string) float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return f
+}
+
+//ServeHTTP writes the metrics.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		up         = &metric{name: "gorcon_up", kind: "gauge", help: "1 if the rcon connection is authenticated."}
+		players    = &metric{name: "gorcon_players", kind: "gauge", help: "Players online per team."}
+		tickets    = &metric{name: "gorcon_tickets", kind: "gauge", help: "Tickets left per team."}
+		elapsed    = &metric{name: "gorcon_round_elapsed_seconds", kind: "gauge", help: "Time since the round started."}
+		remaining  = &metric{name: "gorcon_round_remaining_seconds", kind: "gauge", help: "Time left in the round."}
+		queued     = &metric{name: "gorcon_rcon_queue_depth", kind: "gauge", help: "Commands waiting to be written."}
+		commands   = &metric{name: "gorcon_rcon_commands_total", kind: "counter", help: "Commands written."}
+		latency    = &metric{name: "gorcon_rcon_command_latency_seconds", kind: "summary", help: "Time between commands & their replies."}
+		reconnects = &metric{name: "gorcon_rcon_reconnects_total", kind: "counter", help: "Successful reconnections."}
+		failures   = &metric{name: "gorcon_rcon_auth_failures_total", kind: "counter", help: "Rejected logins."}
+		sent       = &metric{name: "gorcon_rcon_sent_bytes_total", kind: "counter", help: "Bytes written to the rcon connection."}
+		received   = &metric{name: "gorcon_rcon_received_bytes_total", kind: "counter", help: "Bytes read from the rcon connection."}
+		clients    = &metric{name: "gorcon_websocket_clients", kind: "gauge", help: "Open log websockets."}
+	)
+	var ids []string
+	for id := range m.trackers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		t := m.trackers[id]
+		s := t.Status()
+		v := 0.0
+		if s.Rcon == "authenticated" {
+			v = 1
+		}
+		up.add(v, "server", id)
+		teams := map[string]float64{"national": 0, "royal": 0}
+		for _, p := range s.Players {
+			if p.Connected != "1" { //still connecting
+				continue
+			}
+			switch p.Team {
+			case "1":
+				teams["national"]++
+			case "2":
+				teams["royal"]++
+			}
+		}
+		players.add(teams["national"], "server", id, "team", "national")
+		players.add(teams["royal"], "server", id, "team", "royal")
+		tickets.add(number(s.Game.Ntickets), "server", id, "team", "national")
+		tickets.add(number(s.Game.Rtickets), "server", id, "team", "royal")
+		elapsed.add(number(s.Game.Elapsed), "server", id)
+		remaining.add(number(s.Game.Remaining), "server", id)
+		st := t.Rcon.Stats()
+		queued.add(float64(st.Queued), "server", id)
+		commands.add(float64(st.Commands), "server", id)
+		latency.samples = append(latency.samples,
+			sample{fmt.Sprintf("_sum{server=%q}", id), st.Latency.Seconds()},
+			sample{fmt.Sprintf("_count{server=%q}", id), float64(st.Timed)})
+		reconnects.add(float64(st.Reconnects), "server", id)
+		failures.add(float64(st.AuthFailures), "server", id)
+		sent.add(float64(st.BytesSent), "server", id)
+		received.add(float64(st.BytesReceived), "server", id)
+	}
+	list := []*metric{up, players, tickets, elapsed, remaining, queued, commands, latency, reconnects, failures, sent, received}
+	if m.web != nil {
+		clients.add(float64(m.web.Clients()))
+		list = append(list, clients)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	b := bufio.NewWriter(w)
+	for _, f := range list {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		for _, s := range f.samples {
+			fmt.Fprintf(b, "%s%s %s\n", f.name, s.labels, strconv.FormatFloat(s.value, 'g', -1, 64))
+		}
+	}
+	b.Flush()
+}
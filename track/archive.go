@@ -0,0 +1,236 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+archive methods keep chat & events in daily files under the 'archive' directory
+('2006-01-02.jsonl', one JSON record per line, UTC dates) so they can be searched &
+exported later. The policy is read from 'archive.json'.
+*/
+
+//
+package track
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//archiveDay is the layout of archive file names.
+const archiveDay = "2006-01-02"
+
+/*
+archivePolicy configures the archive.
+
+	Enabled - archive events.
+	Days    - days of files to keep, 0 keeps everything.
+	Types   - event types archived ("chat", "player", "game", "moderation", "match").
+*/
+type archivePolicy struct {
+	Enabled bool
+	Days    int
+	Types   []string
+}
+
+//Record is an archived event.
+type Record struct {
+	Time                      time.Time
+	Type, Name, Nucleus, Text string
+}
+
+//Query selects archived records. Zero fields match everything.
+type Query struct {
+	From, To time.Time
+	Text     string   //case insensitive text search
+	Player   string   //name (substring) or nucleus id
+	Types    []string //event types
+	Limit    int      //most recent records returned
+}
+
+//defaultArchivePolicy returns the policy used when 'archive.json' does not exist.
+func defaultArchivePolicy() archivePolicy {
+	return archivePolicy{
+		Enabled: true,
+		Days:    30,
+		Types:   []string{"chat", "player", "moderation", "match"},
+	}
+}
+
+//store appends an event to the archive, starting a new file (and pruning old ones)
+//each day.
+func (t *Tracker) store(typ string, payload interface{}, text string, now time.Time) {
+	pol := &t.archive
+	if !pol.Enabled || !contains(pol.Types, typ) {
+		return
+	}
+	r := Record{Time: now, Type: typ, Text: strings.TrimSpace(text)}
+	switch p := payload.(type) {
+	case message:
+		r.Name = p.Origin
+		if pid, err := strconv.Atoi(p.Pid); err == nil && pid >= 0 && pid < len(t.players) && t.players[pid].Name == p.Origin {
+			r.Nucleus = t.players[pid].Nucleus
+		}
+	case playerEvent:
+		r.Name, r.Nucleus = p.Player.Name, p.Player.Nucleus
+	case action:
+		r.Name, r.Nucleus = p.Name, p.Nucleus
+	}
+	day := now.UTC().Format(archiveDay)
+	if day != t.archived {
+		t.archived = day
+		t.prune(now)
+	}
+	dir := t.path("archive")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Println(err)
+		return
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	f, err := os.OpenFile(filepath.Join(dir, day+".jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		fmt.Println(err)
+	}
+}
+
+//archiveFiles returns the archive files & their dates, oldest first.
+func (t *Tracker) archiveFiles() (files []string, days []time.Time) {
+	list, _ := filepath.Glob(filepath.Join(t.path("archive"), "*.jsonl"))
+	sort.Strings(list)
+	for _, f := range list {
+		day, err := time.Parse(archiveDay, strings.TrimSuffix(filepath.Base(f), ".jsonl"))
+		if err != nil {
+			continue
+		}
+		files, days = append(files, f), append(days, day)
+	}
+	return
+}
+
+//prune removes archive files older than the retention policy.
+func (t *Tracker) prune(now time.Time) {
+	if t.archive.Days <= 0 {
+		return
+	}
+	limit := now.UTC().AddDate(0, 0, -t.archive.Days)
+	files, days := t.archiveFiles()
+	for i, f := range files {
+		if days[i].Add(24 * time.Hour).Before(limit) {
+			if err := os.Remove(f); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+}
+
+//match returns true if the record is selected by the query.
+func (q *Query) match(r *Record) bool {
+	if !q.From.IsZero() && r.Time.Before(q.From) || !q.To.IsZero() && r.Time.After(q.To) {
+		return false
+	}
+	if len(q.Types) > 0 && !contains(q.Types, r.Type) {
+		return false
+	}
+	if q.Player != "" && r.Nucleus != q.Player && !strings.Contains(strings.ToLower(r.Name), strings.ToLower(q.Player)) {
+		return false
+	}
+	return q.Text == "" || strings.Contains(strings.ToLower(r.Text), strings.ToLower(q.Text))
+}
+
+//read returns the records in the archive file name that match q.
+func (q *Query) read(name string) (found []Record, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		var r Record
+		if json.Unmarshal(s.Bytes(), &r) != nil { //line being written
+			continue
+		}
+		if q.match(&r) {
+			found = append(found, r)
+		}
+	}
+	return found, s.Err()
+}
+
+//Search returns the archived records matching q, oldest first. Files are read
+//newest first & only until Limit records are found.
+func (t *Tracker) Search(q Query) ([]Record, error) {
+	var days [][]Record //matches per file, newest first
+	n := 0
+	files, dates := t.archiveFiles()
+	for i := len(files) - 1; i >= 0 && (q.Limit <= 0 || n < q.Limit); i-- {
+		if !q.From.IsZero() && !dates[i].Add(24*time.Hour).After(q.From) || !q.To.IsZero() && dates[i].After(q.To) {
+			continue
+		}
+		list, err := q.read(files[i])
+		if err != nil {
+			return nil, err
+		}
+		days, n = append(days, list), n+len(list)
+	}
+	found := make([]Record, 0, n)
+	for i := len(days) - 1; i >= 0; i-- {
+		found = append(found, days[i]...)
+	}
+	if q.Limit > 0 && len(found) > q.Limit {
+		found = found[len(found)-q.Limit:]
+	}
+	return found, nil
+}
+
+//Export writes the records matching q to w as "csv" or "json".
+func (t *Tracker) Export(w io.Writer, q Query, format string) error {
+	if format != "csv" && format != "json" {
+		return errors.New("unknown export format '" + format + "'")
+	}
+	found, err := t.Search(q)
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		return json.NewEncoder(w).Encode(found)
+	}
+	c := csv.NewWriter(w)
+	c.Write([]string{"Time", "Type", "Name", "Nucleus", "Text"})
+	for _, r := range found {
+		c.Write([]string{r.Time.Format(time.RFC3339), r.Type, r.Name, r.Nucleus, r.Text})
+	}
+	c.Flush()
+	return c.Error()
+}
+
+//contains returns true if list holds s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+archive tests check searching the daily archive files.
+*/
+
+//
+package track
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//TestSearchLimit checks that limited searches return the most recent records,
+//oldest first, without reading older files.
+func TestSearchLimit(t *testing.T) {
+	tr := &Tracker{ID: "test", Dir: t.TempDir()}
+	dir := tr.path("archive")
+	if err := os.MkdirAll(filepath.Join(dir, "2024-05-01.jsonl"), 0755); err != nil { //unreadable
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"2024-05-02.jsonl": `{"Type":"chat","Text":"one"}` + "\n" + `{"Type":"chat","Text":"two"}` + "\n",
+		"2024-05-03.jsonl": `{"Type":"chat","Text":"three"}` + "\n" + `{"Type":"game","Text":"skip"}` + "\n" + `{"Type":"chat","Text":"four"}` + "\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	found, err := tr.Search(Query{Types: []string{"chat"}, Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range found {
+		got = append(got, r.Text)
+	}
+	if len(got) != 3 || got[0] != "two" || got[1] != "three" || got[2] != "four" {
+		t.Errorf("got %v, want [two three four]", got)
+	}
+	if _, err := tr.Search(Query{}); err == nil {
+		t.Error("unlimited search did not read the oldest file")
+	}
+}
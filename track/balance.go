@@ -0,0 +1,185 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+balance methods are used to keep teams even by size & score. The policy is kept in
+'balance.json'.
+*/
+
+//
+package track
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+/*
+balancePolicy configures the team auto-balancer.
+
+	SizeDiff   - team size difference that triggers a move (at least 2, as moving a
+	             player off a team 1 bigger only makes the other team bigger).
+	ScoreRatio - stronger/weaker team score ratio that triggers a swap (0 disables).
+	MinPlayers - players needed before scores are balanced.
+	Wait       - time between balancing moves, giving the player list time to update.
+	Recent     - players who joined within this time are preferred for moves.
+	Exempt     - roles that are never moved.
+	Command    - rcon command used to switch a player, %d is the player id.
+	Announce   - template sent to chat before a switch (see alias templates).
+*/
+type balancePolicy struct {
+	Enabled      bool
+	SizeDiff     int
+	ScoreRatio   float64
+	MinPlayers   int
+	Wait, Recent string
+	Exempt       []string
+	Command      string
+	Announce     string
+	wait, recent time.Duration
+	announce     *template.Template
+}
+
+//defaultBalancePolicy returns the policy used when 'balance.json' does not exist.
+func defaultBalancePolicy() balancePolicy {
+	return balancePolicy{
+		SizeDiff:   2,
+		ScoreRatio: 2,
+		MinPlayers: 8,
+		Wait:       "30s",
+		Recent:     "2m",
+		Exempt:     []string{"vip", "trial", "moderator", "admin", "owner"},
+		Command:    "bf2cc switchplayer %d",
+		Announce:   "Balancing teams: {{.Target.Name}} moves to the {{enemy .Target}}.",
+	}
+}
+
+//compile parses the policy durations & announcement template.
+func (b *balancePolicy) compile() (err error) {
+	if b.wait, err = time.ParseDuration(b.Wait); err != nil {
+		return
+	}
+	if b.recent, err = time.ParseDuration(b.Recent); err != nil {
+		return
+	}
+	b.announce, err = template.New("balance").Funcs(funcs).Parse(b.Announce)
+	return
+}
+
+//teamStats holds the connected & movable players of one team.
+type teamStats struct {
+	size, score int
+	movable     []int
+}
+
+//teams returns the stats for National (1) & Royal (2).
+func (t *Tracker) teams(exempt []string) (n, r teamStats) {
+	for key := range t.players {
+		p := &t.players[key]
+		if p.Name == "" || p.Connected != "1" {
+			continue
+		}
+		ts := &n
+		if p.Team == "2" {
+			ts = &r
+		} else if p.Team != "1" {
+			continue
+		}
+		score, _ := strconv.Atoi(p.Score)
+		ts.size++
+		ts.score += score
+		if !t.exempt(key, exempt) {
+			ts.movable = append(ts.movable, key)
+		}
+	}
+	return
+}
+
+//candidates orders movable players: dead first, then recent joiners, then by score
+//(lowest first unless strongest is set).
+func (t *Tracker) candidates(list []int, strongest bool) []int {
+	rank := func(key int) int {
+		p := &t.players[key]
+		r := 0
+		if p.Alive != "0" {
+			r += 2
+		}
+		if time.Since(p.Joined) > t.balance.recent {
+			r++
+		}
+		return r
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		ri, rj := rank(list[i]), rank(list[j])
+		if ri != rj {
+			return ri < rj
+		}
+		si, _ := strconv.Atoi(t.players[list[i]].Score)
+		sj, _ := strconv.Atoi(t.players[list[j]].Score)
+		if strongest {
+			return si > sj
+		}
+		return si < sj
+	})
+	return list
+}
+
+//switchTeam announces & switches the player in slot key to the other team.
+func (t *Tracker) switchTeam(key int) {
+	p := &t.players[key]
+	if pol := &t.balance; pol.announce != nil {
+		text, err := execute(pol.announce, context{Target: p, Player: p, Game: t.game})
+		if err != nil {
+			fmt.Println(err)
+		} else if text != "" {
+			t.Rcon.Enqueue("bf2cc sendserverchat " + text)
+		}
+	}
+	t.moderated("balance", p, "", "moved to "+enemy(p), fmt.Sprintf("BALANCE: %s moved from %s to %s\n", p.Name, p.team(), enemy(p)))
+	t.Rcon.Enqueue(fmt.Sprintf(t.balance.Command, key))
+}
+
+//balanceCheck looks for uneven teams & switches players to even them out. Runs after
+//each player list update.
+func (t *Tracker) balanceCheck() {
+	pol := &t.balance
+	if !pol.Enabled || t.match != nil || time.Since(t.balanced) < pol.wait {
+		return
+	}
+	n, r := t.teams(pol.Exempt)
+	big, small := n, r
+	if r.size > n.size {
+		big, small = r, n
+	}
+	if pol.SizeDiff > 0 && big.size-small.size >= max2(pol.SizeDiff, 2) {
+		if c := t.candidates(big.movable, false); len(c) > 0 {
+			t.switchTeam(c[0])
+			t.balanced = time.Now()
+		}
+		return
+	}
+	if pol.ScoreRatio <= 0 || n.size+r.size < pol.MinPlayers || big.size != small.size {
+		return
+	}
+	strong, weak := n, r
+	if r.score > n.score {
+		strong, weak = r, n
+	}
+	if weak.score <= 0 || float64(strong.score)/float64(weak.score) < pol.ScoreRatio {
+		return
+	}
+	s := t.candidates(strong.movable, true)
+	w := t.candidates(weak.movable, false)
+	if len(s) == 0 || len(w) == 0 {
+		return
+	}
+	t.switchTeam(s[0])
+	t.switchTeam(w[0])
+	t.balanced = time.Now()
+}
@@ -0,0 +1,40 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+balance tests check when the balancer moves players.
+*/
+
+//
+package track
+
+import (
+	"strconv"
+	"testing"
+)
+
+//TestBalanceOddTeams checks that a 1 player difference is left alone even with a
+//SizeDiff of 1, while a 2 player difference is evened out.
+func TestBalanceOddTeams(t *testing.T) {
+	tr, lines := testTracker(t)
+	tr.balance = defaultBalancePolicy()
+	tr.balance.Enabled, tr.balance.SizeDiff, tr.balance.Announce, tr.balance.Exempt = true, 1, "", nil
+	if err := tr.balance.compile(); err != nil {
+		t.Fatal(err)
+	}
+	for key, team := range []string{"1", "1", "1", "2", "2"} {
+		tr.players[key] = player{Name: "p" + strconv.Itoa(key), Team: team, Connected: "1", Alive: "0"}
+	}
+	tr.balanceCheck()
+	if !tr.balanced.IsZero() {
+		t.Fatal("balanced teams of 3 & 2")
+	}
+	tr.players[5] = player{Name: "p5", Team: "1", Connected: "1", Alive: "0"}
+	tr.balanceCheck()
+	if l := next(t, lines); l != "bf2cc switchplayer 0" {
+		t.Errorf("got %q, want a switch", l)
+	}
+}
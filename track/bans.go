@@ -0,0 +1,251 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+bans and their methods are used to kick & ban players. The ban list is kept in
+'bans.json' keyed by nucleus id (or profile id when there is no nucleus id).
+*/
+
+//
+package track
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//ban is a single ban list entry. A zero Expires means the ban is permanent.
+type ban struct {
+	Name, Nucleus, Profileid, Reason, Admin string
+	Issued, Expires                         time.Time
+}
+
+//expired returns true if the ban is temporary and its time is up.
+func (b *ban) expired() bool {
+	return !b.Expires.IsZero() && time.Now().After(b.Expires)
+}
+
+//banList maps nucleus (or profile) ids to bans.
+type banList map[string]ban
+
+//kickWait is the minimum time between kicks of a banned player in the same slot.
+const kickWait = 15 * time.Second
+
+//key returns the id a player is banned under.
+func (p *player) key() string {
+	if p.Nucleus != "" {
+		return p.Nucleus
+	}
+	return p.Profileid
+}
+
+//kick removes the player in slot key from the server after telling them why.
+func (t *Tracker) kick(key int, reason string) {
+	if reason != "" {
+		t.private(key, "You have been kicked: "+reason)
+	}
+	t.Rcon.Enqueue(fmt.Sprintf("exec admin.kickPlayer %d", key))
+	t.kicked[key] = time.Now()
+}
+
+//addBan adds the player in slot key to the ban list & kicks them. A zero dur makes
+//the ban permanent. Players without a nucleus or profile id can't be banned.
+func (t *Tracker) addBan(key int, by, reason string, dur time.Duration) error {
+	p := &t.players[key]
+	if p.key() == "" {
+		return fmt.Errorf("can't ban %s: no nucleus or profile id known yet", p.Name)
+	}
+	b := ban{
+		Name:      p.Name,
+		Nucleus:   p.Nucleus,
+		Profileid: p.Profileid,
+		Reason:    reason,
+		Admin:     by,
+		Issued:    time.Now(),
+	}
+	if dur > 0 {
+		b.Expires = b.Issued.Add(dur)
+	}
+	t.bans[p.key()] = b
+	t.saveBans()
+	msg := "banned"
+	if dur > 0 {
+		msg = "banned for " + dur.String()
+	}
+	if reason != "" {
+		msg += ": " + reason
+	}
+	t.moderated("ban", p, by, reason, fmt.Sprintf("%s %s by %s\n", p.Name, msg, by))
+	t.private(key, "You have been "+msg)
+	t.kick(key, "")
+	return nil
+}
+
+//saveBans writes the ban list to 'bans.json'.
+func (t *Tracker) saveBans() {
+	if err := writeJSON(t.path("bans.json"), &t.bans); err != nil {
+		fmt.Println(err)
+	}
+}
+
+//enforce kicks any player on the ban list & drops expired bans.
+func (t *Tracker) enforce() {
+	changed := false
+	for id, b := range t.bans {
+		if b.expired() {
+			delete(t.bans, id)
+			changed = true
+		}
+	}
+	if changed {
+		t.saveBans()
+	}
+	for key := range t.players {
+		p := &t.players[key]
+		if p.Name == "" || p.key() == "" {
+			continue
+		}
+		b, ok := t.banOf(p)
+		if !ok || time.Since(t.kicked[key]) < kickWait {
+			continue
+		}
+		t.moderated("banned", p, b.Admin, b.Reason, fmt.Sprintf("BANNED: %s (%s)\n", p.Name, b.Reason))
+		t.kick(key, "banned: "+b.Reason)
+	}
+}
+
+//banOf returns the ban of p, whether it is kept under the nucleus or profile id.
+func (t *Tracker) banOf(p *player) (ban, bool) {
+	for _, id := range []string{p.Nucleus, p.Profileid} {
+		if b, ok := t.bans[id]; ok && id != "" {
+			return b, true
+		}
+	}
+	for _, b := range t.bans {
+		if p.Nucleus != "" && b.Nucleus == p.Nucleus || p.Profileid != "" && b.Profileid == p.Profileid {
+			return b, true
+		}
+	}
+	return ban{}, false
+}
+
+//ExportBans writes the ban list to w as JSON.
+func (t *Tracker) ExportBans(w io.Writer) error {
+	t.mu.Lock()
+	b, err := json.MarshalIndent(t.bans, "", "    ")
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+//ImportBans reads a JSON ban list from r and merges it into the current ban list.
+//Entries may be keyed by nucleus or profile id & replace those with the same id.
+func (t *Tracker) ImportBans(r io.Reader) error {
+	var list banList
+	if err := json.NewDecoder(r).Decode(&list); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.bans == nil { //not started yet
+		t.bans = make(banList)
+	}
+	for id, b := range list {
+		t.bans[id] = b
+	}
+	t.saveBans()
+	return nil
+}
+
+//ParseDuration is time.ParseDuration with added support for days ("3d"). Ban durations
+//are parsed with it everywhere they can be given.
+func ParseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+//kickCmd handles the in-game 'kick <player> [reason]' command.
+func (t *Tracker) kickCmd(id int, args []string) {
+	key, ok := t.target(id, "kick", args)
+	if !ok {
+		return
+	}
+	reason := strings.Join(args[1:], " ")
+	t.moderated("kick", &t.players[key], t.players[id].Name, reason, fmt.Sprintf("%s kicked by %s: %s\n", t.players[key].Name, t.players[id].Name, reason))
+	t.kick(key, reason)
+}
+
+//banCmd handles the in-game 'ban <player> [reason]' command.
+func (t *Tracker) banCmd(id int, args []string) {
+	key, ok := t.target(id, "ban", args)
+	if !ok {
+		return
+	}
+	if err := t.addBan(key, t.players[id].Name, strings.Join(args[1:], " "), 0); err != nil {
+		t.private(id, err.Error())
+	}
+}
+
+//tempbanCmd handles the in-game 'tempban <player> <duration> [reason]' command.
+func (t *Tracker) tempbanCmd(id int, args []string) {
+	if len(args) < 2 {
+		t.private(id, "usage: !tempban <player> <duration> [reason]")
+		return
+	}
+	dur, err := ParseDuration(args[1])
+	if err != nil || dur <= 0 {
+		t.private(id, fmt.Sprintf("bad duration ('%s')", args[1]))
+		return
+	}
+	key, ok := t.target(id, "tempban", args)
+	if !ok {
+		return
+	}
+	if err := t.addBan(key, t.players[id].Name, strings.Join(args[2:], " "), dur); err != nil {
+		t.private(id, err.Error())
+	}
+}
+
+//unbanCmd handles the in-game 'unban <name|id>' command. Names must match exactly
+//(ignoring case) since banned players are not on the server.
+func (t *Tracker) unbanCmd(id int, args []string) {
+	if len(args) == 0 {
+		t.private(id, "usage: !unban <name|id>")
+		return
+	}
+	term := strings.Join(args, " ")
+	var found []string
+	for key, b := range t.bans {
+		if key == term || b.Profileid == term || strings.EqualFold(b.Name, term) {
+			found = append(found, key)
+		}
+	}
+	switch {
+	case len(found) == 0:
+		t.private(id, fmt.Sprintf("no ban found ('%s')", term))
+	case len(found) > 1:
+		t.private(id, fmt.Sprintf("multiple bans found ('%s'), use the id", term))
+	default:
+		b := t.bans[found[0]]
+		delete(t.bans, found[0])
+		t.saveBans()
+		t.moderated("unban", &player{Name: b.Name, Nucleus: b.Nucleus}, t.players[id].Name, "", fmt.Sprintf("%s unbanned by %s\n", b.Name, t.players[id].Name))
+		t.private(id, fmt.Sprintf("%s unbanned", b.Name))
+	}
+}
@@ -0,0 +1,62 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+ban tests check banning players without ids & importing ban lists.
+*/
+
+//
+package track
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBanWithoutKey(t *testing.T) {
+	tr, lines := testTracker(t)
+	players(tr)
+	tr.admins["1001"] = admin{Name: "Bob", Roles: []string{"owner"}}
+	tr.players[2].Nucleus = ""
+	handled(t, tr, "1\tBob\t1\tGlobal\t[21:20:00]\t!ban Alice cheating")
+	want := `exec game.sayToPlayerWithId 1 "can't ban Alice: no nucleus or profile id known yet"`
+	if l := next(t, lines); l != want {
+		t.Errorf("got %q, want %q", l, want)
+	}
+	if len(tr.bans) != 0 {
+		t.Errorf("bans = %v, want none", tr.bans)
+	}
+}
+
+func TestImportBansBeforeStart(t *testing.T) {
+	tr := &Tracker{ID: "test", Dir: t.TempDir()}
+	if err := tr.ImportBans(strings.NewReader(`{"1001": {"Name": "Bob", "Reason": "aimbot"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if b := tr.bans["1001"]; b.Name != "Bob" || b.Reason != "aimbot" {
+		t.Errorf("imported ban = %+v", b)
+	}
+}
+
+//TestEnforceProfileBan checks that bans kept under a profile id are enforced on
+//players whose nucleus id is known.
+func TestEnforceProfileBan(t *testing.T) {
+	tr, lines := testTracker(t)
+	players(tr)
+	tr.players[2].Profileid = "5002"
+	if err := tr.ImportBans(strings.NewReader(`{"5002": {"Name": "Alice", "Reason": "aimbot"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	tr.enforce()
+	for _, want := range []string{
+		`exec game.sayToPlayerWithId 2 "You have been kicked: banned: aimbot"`,
+		"exec admin.kickPlayer 2",
+	} {
+		if l := next(t, lines); l != want {
+			t.Errorf("got %q, want %q", l, want)
+		}
+	}
+}
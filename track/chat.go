@@ -14,11 +14,13 @@ package track
 import (
 	//"fmt"
 	"strings"
+	"time"
 )
 
 type message struct {
 	Pid, Origin, Team, Type, Time, Text string
 	IsCommand                           bool
+	Received                            time.Time
 }
 
 func parseChat(data string, com chan *message) {
@@ -40,6 +42,8 @@ func parseChat(data string, com chan *message) {
 				Type:   elem[3],
 				Time:   elem[4],
 				Text:   elem[5],
+
+				Received: time.Now(),
 			}
 			if len(m.Text) > 0 {
 				if strings.IndexAny(m.Text, "!/|") == 0 {
@@ -0,0 +1,347 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+clan methods find clan tags in player names and keep clan members & per-round clan
+scores. Tag patterns are read from 'clans.json', members & results are kept in
+'clanstats.json'.
+*/
+
+//
+package track
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+clanPolicy configures clan detection.
+
+	Patterns - regular expressions finding a clan tag in a name. The first capture
+	           group is the tag (the whole match without one).
+	History  - rounds & matches kept in 'clanstats.json'.
+*/
+type clanPolicy struct {
+	Patterns []string
+	History  int
+	patterns []*regexp.Regexp
+}
+
+//member is a player seen wearing a clan's tag.
+type member struct {
+	Name        string
+	First, Last time.Time
+	Rounds      int
+}
+
+//clanRecord holds a clan's members & totals over time.
+type clanRecord struct {
+	Members              map[string]member
+	Rounds, Wins, Losses int
+	Score, Kills, Deaths int
+}
+
+//clanScore is a clan's result for one round.
+type clanScore struct {
+	Team                          string
+	Players, Score, Kills, Deaths int
+}
+
+//clanRound is the scoreboard of one round, per team & per clan.
+type clanRound struct {
+	Map, Winner        string //winning team ("1" National, "2" Royal, "" for a draw)
+	Ended              time.Time
+	Ntickets, Rtickets int
+	Teams, Clans       map[string]clanScore
+}
+
+//clanStats is stored in 'clanstats.json'.
+type clanStats struct {
+	Clans   map[string]*clanRecord
+	Rounds  []clanRound
+	Matches []matchReport
+}
+
+//roundEntry is the best score of a player in the current round.
+type roundEntry struct {
+	Clan, Name, Team     string
+	Score, Kills, Deaths int
+}
+
+//defaultClanPolicy returns the policy used when 'clans.json' does not exist.
+func defaultClanPolicy() clanPolicy {
+	return clanPolicy{
+		Patterns: []string{
+			`^\[([^\]]+)\]`,
+			`^\{([^}]+)\}`,
+			`^\(([^)]+)\)`,
+			`^<([^>]+)>`,
+			`^\|([^|]+)\|`,
+			`^=([^=]+)=`,
+		},
+		History: 50,
+	}
+}
+
+//compile parses the tag patterns.
+func (c *clanPolicy) compile() error {
+	c.patterns = nil
+	for _, p := range c.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return err
+		}
+		c.patterns = append(c.patterns, re)
+	}
+	return nil
+}
+
+//clanOf returns the clan tag in name, or "".
+func (t *Tracker) clanOf(name string) string {
+	for _, re := range t.clans.patterns {
+		if m := re.FindStringSubmatch(name); m != nil {
+			if len(m) > 1 {
+				return strings.TrimSpace(m[1])
+			}
+			return strings.TrimSpace(m[0])
+		}
+	}
+	return ""
+}
+
+//saveClans writes 'clanstats.json'.
+func (t *Tracker) saveClans() {
+	if err := writeJSON(t.path("clanstats.json"), &t.clanStats); err != nil {
+		fmt.Println(err)
+	}
+}
+
+//atoi returns the number in s, 0 when there is none.
+func atoi(s string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
+
+//max2 returns the larger of a & b.
+func max2(a, b int) int {
+	if b > a {
+		return b
+	}
+	return a
+}
+
+//clanCheck records the clan members playing & the best scores of each player this
+//round, and keeps the teams locked during a clan match. Runs after each player list
+//update.
+func (t *Tracker) clanCheck() {
+	now := time.Now()
+	for key := range t.players {
+		p := &t.players[key]
+		if p.Name == "" || p.Connected != "1" {
+			continue
+		}
+		tag := t.clanOf(p.Name)
+		if t.match != nil && t.match.Locked && t.lockTeam(key, tag) {
+			continue
+		}
+		if p.key() == "" {
+			continue
+		}
+		if tag != "" {
+			r := t.clanStats.Clans[tag]
+			if r == nil {
+				r = &clanRecord{Members: make(map[string]member)}
+				t.clanStats.Clans[tag] = r
+			}
+			m, ok := r.Members[p.key()]
+			if !ok {
+				m.First = now
+			}
+			m.Name, m.Last = p.Name, now
+			r.Members[p.key()] = m
+		}
+		e := t.round[p.key()]
+		e.Clan, e.Name, e.Team = tag, p.Name, p.Team
+		e.Score = max2(e.Score, atoi(p.Score))
+		e.Kills = max2(e.Kills, atoi(p.Kills))
+		e.Deaths = max2(e.Deaths, atoi(p.Deaths))
+		t.round[p.key()] = e
+	}
+	t.readyCheck()
+}
+
+//scoreboard adds up the round entries per clan.
+func scoreboard(round map[string]roundEntry) map[string]clanScore {
+	board := make(map[string]clanScore)
+	teams := make(map[string]map[string]int)
+	for _, e := range round {
+		if e.Clan == "" {
+			continue
+		}
+		s := board[e.Clan]
+		s.Players++
+		s.Score += e.Score
+		s.Kills += e.Kills
+		s.Deaths += e.Deaths
+		board[e.Clan] = s
+		if teams[e.Clan] == nil {
+			teams[e.Clan] = make(map[string]int)
+		}
+		teams[e.Clan][e.Team]++
+	}
+	for tag, s := range board { //a clan plays for the team most of its members are on
+		for team, n := range teams[tag] {
+			if n > teams[tag][s.Team] || n == teams[tag][s.Team] && team < s.Team {
+				s.Team = team
+			}
+		}
+		board[tag] = s
+	}
+	return board
+}
+
+//teamboard adds up the round entries per team.
+func teamboard(round map[string]roundEntry) map[string]clanScore {
+	board := make(map[string]clanScore)
+	for _, e := range round {
+		s := board[e.Team]
+		s.Team = e.Team
+		s.Players++
+		s.Score += e.Score
+		s.Kills += e.Kills
+		s.Deaths += e.Deaths
+		board[e.Team] = s
+	}
+	return board
+}
+
+//endClanRound records the scoreboard of the round that was played in g. Rounds
+//played before a match goes live are not counted. Callers must hold t.mu.
+func (t *Tracker) endClanRound(g game) {
+	round := t.round
+	t.round = make(map[string]roundEntry)
+	if t.match != nil && t.match.Phase != "live" {
+		t.matchRestarted()
+		return
+	}
+	if len(round) == 0 && t.match == nil {
+		return
+	}
+	r := clanRound{
+		Map:      g.Map,
+		Ended:    time.Now(),
+		Ntickets: atoi(g.Ntickets),
+		Rtickets: atoi(g.Rtickets),
+		Teams:    teamboard(round),
+		Clans:    scoreboard(round),
+	}
+	if t.match != nil && t.match.Locked { //match clans play for their locked team
+		for tag, team := range t.match.Teams {
+			if c, ok := r.Clans[tag]; ok {
+				c.Team = team
+				r.Clans[tag] = c
+			}
+		}
+	}
+	if r.Ntickets > r.Rtickets {
+		r.Winner = "1"
+	} else if r.Rtickets > r.Ntickets {
+		r.Winner = "2"
+	}
+	for tag, s := range r.Clans {
+		c := t.clanStats.Clans[tag]
+		if c == nil {
+			continue
+		}
+		c.Rounds++
+		c.Score += s.Score
+		c.Kills += s.Kills
+		c.Deaths += s.Deaths
+		switch {
+		case r.Winner == "":
+		case s.Team == r.Winner:
+			c.Wins++
+		default:
+			c.Losses++
+		}
+		for id, e := range round {
+			if m, ok := c.Members[id]; ok && e.Clan == tag {
+				m.Rounds++
+				c.Members[id] = m
+			}
+		}
+	}
+	if len(r.Clans) > 0 {
+		t.clanStats.Rounds = append(t.clanStats.Rounds, r)
+		if h := t.clans.History; h > 0 && len(t.clanStats.Rounds) > h {
+			t.clanStats.Rounds = t.clanStats.Rounds[len(t.clanStats.Rounds)-h:]
+		}
+		t.saveClans()
+	}
+	if t.match != nil {
+		t.matchRound(r)
+	}
+}
+
+//clanCmd handles the in-game 'clan [tag]' command: the clans online, or a clan's
+//record.
+func (t *Tracker) clanCmd(id int, args []string) {
+	if len(args) == 0 {
+		online := make(map[string]int)
+		for key := range t.players {
+			if tag := t.clanOf(t.players[key].Name); tag != "" {
+				online[tag]++
+			}
+		}
+		if len(online) == 0 {
+			t.private(id, "no clans online")
+			return
+		}
+		var list []string
+		for tag, n := range online {
+			list = append(list, fmt.Sprintf("%s (%d)", tag, n))
+		}
+		sort.Strings(list)
+		t.private(id, "Clans online: "+strings.Join(list, ", "))
+		return
+	}
+	r, ok := t.clanStats.Clans[args[0]]
+	if !ok {
+		t.private(id, fmt.Sprintf("unknown clan ('%s')", args[0]))
+		return
+	}
+	kd := float64(r.Kills)
+	if r.Deaths > 0 {
+		kd /= float64(r.Deaths)
+	}
+	t.private(id, fmt.Sprintf("%s: %d members, %d rounds (%d won, %d lost), %d pts, K/D %.2f",
+		args[0], len(r.Members), r.Rounds, r.Wins, r.Losses, r.Score, kd))
+}
+
+//Clans returns a copy of the clan records, round results & match reports.
+func (t *Tracker) Clans() clanStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := clanStats{
+		Clans:   make(map[string]*clanRecord),
+		Rounds:  append([]clanRound(nil), t.clanStats.Rounds...),
+		Matches: append([]matchReport(nil), t.clanStats.Matches...),
+	}
+	for tag, r := range t.clanStats.Clans {
+		c := *r
+		c.Members = make(map[string]member)
+		for id, m := range r.Members {
+			c.Members[id] = m
+		}
+		s.Clans[tag] = &c
+	}
+	return s
+}
@@ -13,154 +13,147 @@ package track
 
 import (
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 )
 
+//chatHistory is the number of recent chat messages kept by the Tracker.
+const chatHistory = 200
+
 //interpret monitors com channel for messages sent from parseChat(). Used to interpret
-//commands in messages.
+//commands in messages. Every message is handled on its own so a bad command never
+//stops the rest of the batch, and the channel is always drained so parseChat can
+//finish.
 func (t *Tracker) interpret(com chan *message) {
 	for m := range com {
-		id, _ := strconv.Atoi(m.Pid)
-		split := strings.Split(m.Text[1:], " ")
-		Log(fmt.Sprintf("%s[%s]: %s\n", m.Origin, m.Time, m.Text))
+		t.emit("chat", *m, fmt.Sprintf("%s[%s]: %s\n", m.Origin, m.Time, m.Text))
+		t.chat = append(t.chat, *m)
+		if len(t.chat) > chatHistory {
+			t.chat = t.chat[len(t.chat)-chatHistory:]
+		}
+		if !t.moderate(m) {
+			continue
+		}
+		t.relayOut(m)
 		if m.IsCommand {
-			line := ""
-			permitted := false
-			public := false
-			//if split[0] == "" {
-			//	return
-			//}
-			if _, ok := t.aliases[split[0]]; !ok {
-				return
-			}
-			if t.admins[t.players[id].Nucleus].Power >= t.aliases[split[0]].Power {
-				permitted = true
-			}
-			if t.aliases[split[0]].Power == 0 {
-				//public alias (no power check)
-				public = true
-			}
-			if !public && !permitted {
-				//fmt.Printf("%s - not enough power\n", t.players[id].Name)
-				continue
-			}
-			switch {
-			case split[0] == "testkick" || split[0] == "testban":
-				if len(split) > 1 {
-					r := t.players.find(split[1])
-					if len(r) == 1 {
-						split[1] = t.players[r[0]].Name
-						//t.process("send", t.aliases[split[0]].Command+" "+strings.Join(split[1:], " "))
-						l := fmt.Sprintf(`exec game.sayToPlayerWithId %d "%s"`, id, fmt.Sprintf("Pretending to %s %s", split[0], split[1]))
-						t.Rcon.Enqueue(l)
-					} else if len(r) > 1 {
-						l := fmt.Sprintf(`exec game.sayToPlayerWithId %d "%s"`, id, fmt.Sprintf("multiple players found ('%s')", split[1]))
-						t.Rcon.Enqueue(l)
-					} else {
-						fmt.Printf("No results found.")
-					}
-				}
-			case split[0] == "promote" || split[0] == "demote":
-				val := "1"
-				if split[0] == "demote" {
-					val = "0"
-				}
-				if len(split) > 1 {
-					r := t.players.find(split[1])
-					if len(r) == 1 {
-						name := t.players[r[0]].Name
-						nucleus := t.players[r[0]].Nucleus
-						l := fmt.Sprintf(`exec game.setPersonaVipStatus %s %s %s`, name, nucleus, val)
-						t.Rcon.Enqueue(l)
-					} else if len(r) > 1 {
-						l := fmt.Sprintf(`exec game.sayToPlayerWithId %d "%s"`, id, fmt.Sprintf("multiple players found ('%s')", split[1]))
-						t.Rcon.Enqueue(l)
-					} else {
-						l := fmt.Sprintf(`exec game.sayToPlayerWithId %d "%s"`, id, fmt.Sprintf("player not found ('%s')", split[1]))
-						t.Rcon.Enqueue(l)
-					}
-				}
-			case split[0] == "info":
-				if len(split) > 1 {
-					r := t.players.find(split[1])
-					if len(r) == 1 {
-						l := fmt.Sprintf(`exec game.sayToPlayerWithId %d "%s"`, id, t.aliases[split[0]].Message+" "+line)
-						l = t.parseTags(r[0], l)
-						t.Rcon.Enqueue(l)
-					} else if len(r) > 1 {
-						l := fmt.Sprintf(`exec game.sayToPlayerWithId %d "%s"`, id, fmt.Sprintf("multiple players found ('%s')", split[1]))
-						t.Rcon.Enqueue(l)
-					} else {
-						l := fmt.Sprintf(`exec game.sayToPlayerWithId %d "%s"`, id, fmt.Sprintf("player not found ('%s')", split[1]))
-						t.Rcon.Enqueue(l)
-					}
-				}
-			default:
-				var cmd string
-				if len(split) > 1 {
-					line = strings.Join(split[1:], " ")
-				}
-				switch t.aliases[split[0]].Visibility {
-				case "public":
-					cmd = fmt.Sprintf(`bf2cc sendserverchat %s`, t.aliases[split[0]].Message+" "+line)
-				case "private":
-					cmd = fmt.Sprintf(`exec game.sayToPlayerWithId %d "%s"`, id, t.aliases[split[0]].Message+" "+line)
-				case "server":
-					cmd = t.aliases[split[0]].Message + " " + line
-				default:
-					continue
-				}
-				full := t.parseTags(id, cmd)
-				t.Rcon.Enqueue(full)
-			}
+			t.command(m)
 		}
 	}
 }
 
-//parseTags scans the message text for special tags used to represent certain data
-//like player name, etc.
-func (t *Tracker) parseTags(pid int, m string) string {
-	tags, err := regexp.Compile(`\$+[A-Z]+\$`)
+//builtins are commands handled in code rather than by an alias message. Each is
+//called with the slot id of the player that issued it and the command arguments.
+var builtins = map[string]func(t *Tracker, id int, args []string){
+	"grant":   func(t *Tracker, id int, args []string) { t.grant(id, args, false) },
+	"revoke":  func(t *Tracker, id int, args []string) { t.grant(id, args, true) },
+	"promote": func(t *Tracker, id int, args []string) { t.vip(id, args, "1") },
+	"demote":  func(t *Tracker, id int, args []string) { t.vip(id, args, "0") },
+	"kick":    func(t *Tracker, id int, args []string) { t.kickCmd(id, args) },
+	"ban":     func(t *Tracker, id int, args []string) { t.banCmd(id, args) },
+	"tempban": func(t *Tracker, id int, args []string) { t.tempbanCmd(id, args) },
+	"unban":   func(t *Tracker, id int, args []string) { t.unbanCmd(id, args) },
+	"whois":   func(t *Tracker, id int, args []string) { t.whoisCmd(id, args) },
+	"clan":    func(t *Tracker, id int, args []string) { t.clanCmd(id, args) },
+	"match":   func(t *Tracker, id int, args []string) { t.matchCmd(id, args) },
+	"ready":   func(t *Tracker, id int, args []string) { t.readyCmd(id, true) },
+	"unready": func(t *Tracker, id int, args []string) { t.readyCmd(id, false) },
+}
+
+func init() {
+	//registered here since pick replays commands through builtins
+	builtins["pick"] = func(t *Tracker, id int, args []string) { t.pick(id, args) }
+}
+
+//command runs the alias or built-in command found in a single chat message.
+func (t *Tracker) command(m *message) {
+	id, err := strconv.Atoi(m.Pid)
+	if err != nil || id < 0 || id >= len(t.players) {
+		return
+	}
+	split := strings.Fields(m.Text[1:])
+	if len(split) == 0 {
+		return
+	}
+	t.run(id, split[0], split[1:])
+}
+
+//run checks permissions and runs the named command for the player in slot id.
+//'pick' is always allowed since the command it replays is checked again here.
+func (t *Tracker) run(id int, name string, args []string) {
+	f, builtin := builtins[name]
+	if _, ok := t.aliases[name]; !ok && !builtin {
+		t.private(id, fmt.Sprintf("unknown command ('%s')", name))
+		return
+	}
+	if name != "pick" && !t.permitted(id, name) {
+		t.private(id, fmt.Sprintf("permission denied ('%s')", name))
+		return
+	}
+	if name != "pick" && t.elevated(name) {
+		text := strings.TrimSpace(name + " " + strings.Join(args, " "))
+		t.notify("command", fmt.Sprintf("%s used !%s", t.players[id].Name, text), t.players[id])
+	}
+	if builtin {
+		f(t, id, args)
+		return
+	}
+	ctx := context{
+		Caller: &t.players[id],
+		Player: &t.players[id],
+		Game:   t.game,
+		Args:   args,
+		Line:   strings.Join(args, " "),
+	}
+	visibility := t.aliases[name].Visibility
+	if name == "info" {
+		key, ok := t.target(id, name, args)
+		if !ok {
+			return
+		}
+		ctx.Target = &t.players[key]
+		ctx.Player = ctx.Target
+		ctx.Args = args[1:]
+		ctx.Line = strings.Join(args[1:], " ")
+		visibility = "private"
+	} else if len(args) > 0 {
+		if r, _ := t.resolve(id, args[0]); len(r) == 1 {
+			ctx.Target = &t.players[r[0]]
+		}
+	}
+	text, err := t.render(name, ctx)
 	if err != nil {
 		fmt.Println(err)
+		t.private(id, fmt.Sprintf("alias error ('%s')", name))
+		return
 	}
-	result := tags.ReplaceAllFunc([]byte(m), func(b []byte) (r []byte) {
-		//fmt.Println(fmt.Sprintf("%s", b))
-		//return []byte("value")
-		switch fmt.Sprintf("%s", b) {
-		case "$PN$":
-			r = []byte(t.players[pid].Name)
-		case "$PL$":
-			r = []byte(t.players[pid].Level)
-		case "$PT$":
-			if t.players[pid].Team == "1" {
-				r = []byte("National")
-			}
-			r = []byte("Royal")
-		case "$PC$":
-			r = []byte(t.players[pid].Kit)
-		case "$ET$":
-			if t.players[pid].Team == "2" {
-				r = []byte("National")
-			}
-			r = []byte("Royal")
-		case "$PTN$":
-			if t.players[pid].Team == "1" {
-				r = []byte(t.game.Nsize)
-			}
-			r = []byte(t.game.Rsize)
-		case "$VIP$":
-			if t.players[pid].Vip == "1" {
-				r = []byte("VIP")
-			} else {
-				r = []byte("")
-			}
-		case "$PING$":
-			r = []byte(t.players[pid].Ping)
-		}
+	switch visibility {
+	case "public":
+		t.Rcon.Enqueue(fmt.Sprintf(`bf2cc sendserverchat %s`, text))
+	case "private":
+		t.private(id, text)
+	case "server":
+		t.Rcon.Enqueue(text)
+	}
+}
+
+//vip sets the VIP status of the player named in args to val ("1" or "0").
+func (t *Tracker) vip(id int, args []string, val string) {
+	command := "promote"
+	if val == "0" {
+		command = "demote"
+	}
+	key, ok := t.target(id, command, args)
+	if !ok {
 		return
-	})
-	return fmt.Sprintf("%s", result)
+	}
+	name := t.players[key].Name
+	nucleus := t.players[key].Nucleus
+	l := fmt.Sprintf(`exec game.setPersonaVipStatus %s %s %s`, name, nucleus, val)
+	t.Rcon.Enqueue(l)
+}
+
+//private sends a message to the player in slot id only.
+func (t *Tracker) private(id int, s string) {
+	s = strings.Replace(s, `"`, `'`, -1)
+	t.Rcon.Enqueue(fmt.Sprintf(`exec game.sayToPlayerWithId %d "%s"`, id, s))
 }
@@ -0,0 +1,176 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+command tests feed recorded 'bf2cc clientchatbuffer' output through the chat
+parser & interpreter, with an in-process stand-in for the rcon server.
+*/
+
+//
+package track
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lee8oi/gorcon/log"
+)
+
+//testTracker returns a Tracker with default configuration, logged in to an
+//in-process rcon server. Command lines the server receives are sent on lines.
+func testTracker(t *testing.T) (tr *Tracker, lines <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan string, 100)
+	go func() {
+		c, err := ln.Accept()
+		ln.Close()
+		if err != nil {
+			return
+		}
+		fmt.Fprint(c, "### Digest seed: test\n")
+		r := bufio.NewReader(c)
+		r.ReadString('\n')
+		fmt.Fprint(c, "Authentication successful, rcon ready.\n")
+		for {
+			l, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			received <- strings.TrimSpace(strings.Trim(l, "\u0002"))
+		}
+	}()
+	if Publish == nil {
+		Publish = func(log.Message) {}
+	}
+	if Log == nil {
+		Log = func(string) {}
+	}
+	tr = &Tracker{ID: "test", Dir: t.TempDir()}
+	if err := tr.Rcon.Connect(ln.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Rcon.Login("", "pass"); err != nil {
+		t.Fatal(err)
+	}
+	go tr.Rcon.Init()
+	t.Cleanup(func() { tr.Rcon.Close() })
+	for !tr.Rcon.Ready() {
+		time.Sleep(time.Millisecond)
+	}
+	tr.choices = make(map[int]choice)
+	tr.kicked = make(map[int]time.Time)
+	tr.clanStats.Clans = make(map[string]*clanRecord)
+	tr.round = make(map[string]roundEntry)
+	tr.load()
+	return tr, received
+}
+
+//next returns the next command line received by the rcon stand-in.
+func next(t *testing.T, lines <-chan string) string {
+	t.Helper()
+	select {
+	case l := <-lines:
+		return l
+	case <-time.After(5 * time.Second):
+		t.Fatal("no rcon command received")
+	}
+	return ""
+}
+
+//handled passes data to t.handle, failing if it does not return.
+func handled(t *testing.T, tr *Tracker, data string) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		tr.handle(data)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("chat batch was not drained")
+	}
+}
+
+//chatbuffer is recorded 'bf2cc clientchatbuffer' output: pid, name, team, channel,
+//time & text separated by tabs, one message per line.
+const chatbuffer = "1\tBob\t1\tGlobal\t[21:14:03]\thi all\r" +
+	"1\tBob\t1\tGlobal\t[21:14:09]\t!nope\r" +
+	"2\tAlice\t2\tTeam\t[21:14:12]\tgg\r" +
+	"-1\tAdmin\t0\tServerMessage\t[21:14:15]\tround starting\r" +
+	"2\tAlice\t2\tGlobal\t[21:14:20]\t!args one two\r" +
+	"1\tBob\t1\tGlobal\t[21:14:26]\tbye"
+
+//players fills slots 1 & 2 with the players found in chatbuffer.
+func players(tr *Tracker) {
+	tr.players[1] = player{Name: "Bob", Team: "1", Nucleus: "1001", Connected: "1"}
+	tr.players[2] = player{Name: "Alice", Team: "2", Nucleus: "1002", Connected: "1"}
+	tr.aliases["args"] = alias{Visibility: "private", Message: "{{len .Args}}:{{range .Args}}[{{.}}]{{end}}"}
+	tr.compile()
+}
+
+func TestInterpretDrainsBatch(t *testing.T) {
+	tr, lines := testTracker(t)
+	players(tr)
+	handled(t, tr, chatbuffer)
+	if len(tr.chat) != 6 {
+		t.Fatalf("got %d messages, want 6", len(tr.chat))
+	}
+	if last := tr.chat[5]; last.Origin != "Bob" || last.Text != "bye" || last.IsCommand {
+		t.Errorf("last message = %+v", last)
+	}
+	want := []string{
+		`exec game.sayToPlayerWithId 1 "unknown command ('nope')"`,
+		`exec game.sayToPlayerWithId 2 "2:[one][two]"`,
+	}
+	for _, w := range want {
+		if l := next(t, lines); l != w {
+			t.Errorf("got %q, want %q", l, w)
+		}
+	}
+}
+
+func TestInterpretUnknownCommand(t *testing.T) {
+	tr, lines := testTracker(t)
+	players(tr)
+	for _, text := range []string{"!nope", "/nope now", "|nope"} {
+		handled(t, tr, "2\tAlice\t2\tGlobal\t[21:15:00]\t"+text)
+		want := `exec game.sayToPlayerWithId 2 "unknown command ('nope')"`
+		if l := next(t, lines); l != want {
+			t.Errorf("%s: got %q, want %q", text, l, want)
+		}
+	}
+}
+
+func TestInterpretArguments(t *testing.T) {
+	tr, lines := testTracker(t)
+	players(tr)
+	tests := []struct{ text, want string }{
+		{"!args", "0:"},
+		{"!args one", "1:[one]"},
+		{"!args  one   two ", "2:[one][two]"},
+		{"/args one two three", "3:[one][two][three]"},
+		{`|args "quoted" x`, "2:['quoted'][x]"},
+	}
+	for _, test := range tests {
+		handled(t, tr, "1\tBob\t1\tGlobal\t[21:16:00]\t"+test.text)
+		want := `exec game.sayToPlayerWithId 1 "` + test.want + `"`
+		if l := next(t, lines); l != want {
+			t.Errorf("%q: got %q, want %q", test.text, l, want)
+		}
+	}
+	handled(t, tr, "1\tBob\t1\tGlobal\t[21:16:30]\tnot a command !args x\r1\tBob\t1\tGlobal\t[21:16:31]\t!args last")
+	if l := next(t, lines); l != `exec game.sayToPlayerWithId 1 "1:[last]"` {
+		t.Errorf("plain chat ran a command, got %q", l)
+	}
+}
@@ -0,0 +1,155 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+control methods expose Tracker state & moderation actions to other packages, like
+the web admin panel. All of them are safe to call while the Tracker is running.
+*/
+
+//
+package track
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Status is a snapshot of a Tracker's game state, connected players & recent chat.
+type Status struct {
+	ID      string
+	Rcon    string
+	Updated time.Time
+	Game    game
+	Players []player
+	Chat    []message
+}
+
+//Status returns a snapshot of the Tracker state.
+func (t *Tracker) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := Status{
+		ID:      t.ID,
+		Rcon:    t.Rcon.Status(),
+		Updated: t.updated,
+		Game:    t.game,
+		Chat:    append([]message(nil), t.chat...),
+	}
+	for key := range t.players {
+		if t.players[key].Name != "" {
+			s.Players = append(s.Players, t.players[key])
+		}
+	}
+	return s
+}
+
+//Chat returns the recent chat messages received after since.
+func (t *Tracker) Chat(since time.Time) (list []message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, m := range t.chat {
+		if m.Received.After(since) {
+			list = append(list, m)
+		}
+	}
+	return
+}
+
+//Bans returns a copy of the ban list.
+func (t *Tracker) Bans() banList {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list := make(banList)
+	for id, b := range t.bans {
+		list[id] = b
+	}
+	return list
+}
+
+//slot checks that pid is an occupied slot, and when name is given that it still
+//holds that player. Callers must hold t.mu.
+func (t *Tracker) slot(pid int, name string) error {
+	if pid < 0 || pid >= len(t.players) || t.players[pid].Name == "" {
+		return errors.New("no player in slot " + strconv.Itoa(pid))
+	}
+	if name != "" && t.players[pid].Name != name {
+		return fmt.Errorf("%s is no longer in slot %d", name, pid)
+	}
+	return nil
+}
+
+//connected fails when rcon can't take commands yet. Enqueue would wait for it.
+func (t *Tracker) connected() error {
+	if !t.Rcon.Ready() {
+		return errors.New("rcon is not connected")
+	}
+	return nil
+}
+
+//oneLine replaces line breaks in s with spaces, as rcon takes one command per line.
+func oneLine(s string) string {
+	return strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(s)
+}
+
+//Say sends text to the server chat.
+func (t *Tracker) Say(text string) error {
+	if err := t.connected(); err != nil {
+		return err
+	}
+	text = strings.TrimSpace(oneLine(text))
+	if text == "" {
+		return errors.New("nothing to say")
+	}
+	t.Rcon.Enqueue("bf2cc sendserverchat " + text)
+	return nil
+}
+
+//Kick kicks the player in slot pid. Name, when given, must match the player in the
+//slot. By is recorded in the log.
+func (t *Tracker) Kick(pid int, name, reason, by string) error {
+	if err := t.connected(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.slot(pid, name); err != nil {
+		return err
+	}
+	t.moderated("kick", &t.players[pid], by, reason, fmt.Sprintf("%s kicked by %s: %s\n", t.players[pid].Name, by, reason))
+	t.kick(pid, reason)
+	return nil
+}
+
+//Ban bans & kicks the player in slot pid. A zero dur makes the ban permanent.
+func (t *Tracker) Ban(pid int, name, reason, by string, dur time.Duration) error {
+	if err := t.connected(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.slot(pid, name); err != nil {
+		return err
+	}
+	return t.addBan(pid, by, reason, dur)
+}
+
+//Map changes the map to the given index in the server map list.
+func (t *Tracker) Map(index int) error {
+	if err := t.connected(); err != nil {
+		return err
+	}
+	t.changeMap(index)
+	return nil
+}
+
+//changeMap changes the map to the given index in the server map list.
+func (t *Tracker) changeMap(index int) {
+	t.Rcon.Enqueue(fmt.Sprintf("exec admin.nextLevel %d", index))
+	t.Rcon.Enqueue("exec admin.runNextLevel")
+}
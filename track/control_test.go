@@ -0,0 +1,51 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+control tests check the exported actions against a Tracker without rcon.
+*/
+
+//
+package track
+
+import (
+	"testing"
+	"time"
+)
+
+//TestControlNotConnected checks that actions fail instead of waiting for rcon.
+func TestControlNotConnected(t *testing.T) {
+	tr := &Tracker{ID: "test"}
+	tr.players[1] = player{Name: "Bob"}
+	done := make(chan error, 4)
+	go func() {
+		done <- tr.Say("hello")
+		done <- tr.Map(0)
+		done <- tr.Kick(1, "Bob", "test", "admin")
+		done <- tr.Ban(1, "Bob", "test", "admin", 0)
+	}()
+	for i := 0; i < 4; i++ {
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Errorf("action %d succeeded without rcon", i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("action waited for rcon")
+		}
+	}
+}
+
+//TestSayOneLine checks that Say can't be used to send a second rcon command.
+func TestSayOneLine(t *testing.T) {
+	tr, lines := testTracker(t)
+	if err := tr.Say("hi\r\nexec admin.kickPlayer 1\n"); err != nil {
+		t.Fatal(err)
+	}
+	if l := next(t, lines); l != "bf2cc sendserverchat hi exec admin.kickPlayer 1" {
+		t.Errorf("got %q", l)
+	}
+}
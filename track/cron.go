@@ -0,0 +1,113 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+cron is a minimal cron expression matcher used by scheduled announcements.
+*/
+
+//
+package track
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//cron holds a parsed 5 field cron expression: minute hour day-of-month month
+//day-of-week. Fields accept *, */n, a-b, a-b/n and comma separated lists. Sunday is
+//0 (or 7).
+type cron struct {
+	minute, hour, dom, month, dow []bool
+	anyDom, anyDow                bool
+}
+
+//parseCron parses a cron expression.
+func parseCron(expr string) (*cron, error) {
+	f := strings.Fields(expr)
+	if len(f) != 5 {
+		return nil, fmt.Errorf("cron '%s': need 5 fields", expr)
+	}
+	var (
+		c   cron
+		err error
+	)
+	if c.minute, err = cronField(f[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if c.hour, err = cronField(f[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if c.dom, err = cronField(f[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if c.month, err = cronField(f[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if c.dow, err = cronField(f[4], 0, 7); err != nil {
+		return nil, err
+	}
+	c.dow[0] = c.dow[0] || c.dow[7]
+	c.anyDom, c.anyDow = f[2] == "*", f[4] == "*"
+	return &c, nil
+}
+
+//cronField parses a single cron field into a set of allowed values.
+func cronField(field string, min, max int) ([]bool, error) {
+	set := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("cron field '%s': bad step", field)
+			}
+			step, part = n, part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("cron field '%s': %s", field, err)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("cron field '%s': %s", field, err)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("cron field '%s': out of range", field)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+//match returns true if the minute containing tm is selected by the expression. As
+//in standard cron, when both day fields are restricted either may match.
+func (c *cron) match(tm time.Time) bool {
+	if !c.minute[tm.Minute()] || !c.hour[tm.Hour()] || !c.month[int(tm.Month())] {
+		return false
+	}
+	dom, dow := c.dom[tm.Day()], c.dow[int(tm.Weekday())]
+	switch {
+	case c.anyDom && c.anyDow:
+		return true
+	case c.anyDom:
+		return dow
+	case c.anyDow:
+		return dom
+	}
+	return dom || dow
+}
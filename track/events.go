@@ -0,0 +1,72 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+events methods publish what the Tracker sees as typed messages: "chat", "player",
+"game", "moderation" and "match". The text of each event is what legacy text clients see.
+*/
+
+//
+package track
+
+import (
+	"fmt"
+	"github.com/lee8oi/gorcon/log"
+	"strings"
+	"time"
+)
+
+//Publish receives every event produced by the Trackers. Defaults to the log web
+//server.
+var Publish func(log.Message)
+
+//action is the payload of "moderation" events.
+type action struct {
+	Action, Name, Nucleus, By, Reason string
+}
+
+//playerEvent is the payload of "player" events.
+type playerEvent struct {
+	Event  string
+	Player player
+}
+
+//emit publishes & archives an event of the given type for the Tracker.
+func (t *Tracker) emit(typ string, payload interface{}, text string) {
+	now := time.Now()
+	t.store(typ, payload, text, now)
+	Publish(log.Message{Type: typ, Server: t.ID, Timestamp: now, Payload: payload, Text: text})
+}
+
+//moderated publishes a "moderation" event for p & notifies the hooks.
+func (t *Tracker) moderated(what string, p *player, by, reason, text string) {
+	a := action{Action: what, Name: p.Name, Nucleus: p.Nucleus, By: by, Reason: reason}
+	t.emit("moderation", a, text)
+	t.notify(what, strings.TrimSpace(text), a)
+}
+
+//playerEvents publishes the connection changes between before & the current player
+//list.
+func (t *Tracker) playerEvents(before *playerList) {
+	var base time.Time
+	for key := range t.players {
+		was, now := &before[key], &t.players[key]
+		switch {
+		case now.Connection == "initial":
+			t.emit("player", playerEvent{"connecting", *now}, fmt.Sprintf("CONNECTING: %s\n", now.Name))
+		case now.Connection == "connected":
+			t.emit("player", playerEvent{"connected", *now}, fmt.Sprintf("CONNECTED: %s\n", now.Name))
+		case was.Name != "" && now.Name == "" && was.Connected == "0":
+			t.emit("player", playerEvent{"interrupted", *was}, fmt.Sprintf("INTERRUPTED: %s\n", was.Name))
+		case was.Name != "" && now.Name == "" && was.Connected == "1":
+			text := fmt.Sprintf("DISCONNECTED: %s\n", was.Name)
+			if !was.Joined.Equal(base) {
+				text = fmt.Sprintf("DISCONNECTED: %s (%s)\n", was.Name, was.playtime())
+			}
+			t.emit("player", playerEvent{"disconnected", *was}, text)
+		}
+	}
+}
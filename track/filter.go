@@ -0,0 +1,261 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+filter methods are used to moderate chat. The policy is kept in 'filter.json' and
+strikes are recorded per nucleus id in 'strikes.json'.
+*/
+
+//
+package track
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+//defaultStrikeWindow is the strike window of policies that don't set one.
+const defaultStrikeWindow = "7d"
+
+/*
+filterPolicy configures the chat filter.
+
+	Words        - words not allowed in chat (whole words, any case).
+	Patterns     - regular expressions not allowed in chat.
+	Repeat       - the same line this many times in a row is spam.
+	Flood        - this many lines within FloodWindow is flooding.
+	Caps         - share of upper case letters (0-1) counted as shouting...
+	CapsMin      - ...in lines with at least this many letters.
+	Penalties    - penalty for the 1st, 2nd, ... strike: "warn", "mute", "kick" or
+	               "tempban". The last one repeats.
+	StrikeWindow - only strikes this recent count towards the penalty ("7d" when
+	               empty, "0" counts every strike).
+	Mute         - how long a muted player's commands are ignored.
+	TempBan      - length of a "tempban" penalty.
+	Exempt       - roles that are never filtered.
+*/
+type filterPolicy struct {
+	Enabled               bool
+	Words, Patterns       []string
+	Repeat, Flood         int
+	FloodWindow           string
+	Caps                  float64
+	CapsMin               int
+	Penalties             []string
+	StrikeWindow          string
+	Mute, TempBan         string
+	Exempt                []string
+	words                 *regexp.Regexp
+	patterns              []*regexp.Regexp
+	window, mute, tempban time.Duration
+	strikeWindow          time.Duration
+}
+
+//strike is a single recorded chat offence.
+type strike struct {
+	Time                  time.Time
+	Reason, Penalty, Text string
+}
+
+//strikeRecord holds every strike for one nucleus id.
+type strikeRecord struct {
+	Name    string
+	Strikes []strike
+}
+
+//chatter holds recent chat activity of the player in a slot.
+type chatter struct {
+	Name    string
+	Last    string
+	Repeats int
+	Times   []time.Time
+	Muted   time.Time
+}
+
+//defaultFilterPolicy returns the policy used when 'filter.json' does not exist.
+func defaultFilterPolicy() filterPolicy {
+	return filterPolicy{
+		Words:        []string{},
+		Patterns:     []string{},
+		Repeat:       3,
+		Flood:        6,
+		FloodWindow:  "10s",
+		Caps:         0.8,
+		CapsMin:      10,
+		Penalties:    []string{"warn", "warn", "mute", "kick", "tempban"},
+		StrikeWindow: defaultStrikeWindow,
+		Mute:         "5m",
+		TempBan:      "1h",
+		Exempt:       []string{"moderator", "admin", "owner"},
+	}
+}
+
+//compile parses the policy word list, patterns & durations.
+func (f *filterPolicy) compile() (err error) {
+	f.words, f.patterns = nil, nil
+	if len(f.Words) > 0 {
+		quoted := make([]string, len(f.Words))
+		for i, w := range f.Words {
+			quoted[i] = regexp.QuoteMeta(w)
+		}
+		if f.words, err = regexp.Compile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`); err != nil {
+			return
+		}
+	}
+	for _, p := range f.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return err
+		}
+		f.patterns = append(f.patterns, re)
+	}
+	if f.window, err = time.ParseDuration(f.FloodWindow); err != nil {
+		return
+	}
+	if f.mute, err = time.ParseDuration(f.Mute); err != nil {
+		return
+	}
+	window := f.StrikeWindow
+	if window == "" {
+		window = defaultStrikeWindow
+	}
+	if f.strikeWindow, err = ParseDuration(window); err != nil {
+		return
+	}
+	f.tempban, err = ParseDuration(f.TempBan)
+	return
+}
+
+//shouting returns true if text is mostly upper case letters.
+func (f *filterPolicy) shouting(text string) bool {
+	if f.Caps <= 0 {
+		return false
+	}
+	letters, upper := 0, 0
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	return letters >= f.CapsMin && float64(upper) >= f.Caps*float64(letters)
+}
+
+/*
+moderate checks a chat message against the filter policy. Offending players get a
+strike & the penalty for their strike count. Returns false if the message should
+not be acted on any further (offence or muted player).
+*/
+func (t *Tracker) moderate(m *message) bool {
+	pol := &t.filter
+	id, err := strconv.Atoi(m.Pid)
+	if !pol.Enabled || err != nil || id < 0 || id >= len(t.players) || t.players[id].Name == "" {
+		return true
+	}
+	c := &t.chatters[id]
+	if c.Name != t.players[id].Name {
+		*c = chatter{Name: t.players[id].Name}
+	}
+	if t.exempt(id, pol.Exempt) {
+		return true
+	}
+	now := time.Now()
+	text := strings.TrimSpace(m.Text)
+	if strings.EqualFold(text, c.Last) {
+		c.Repeats++
+	} else {
+		c.Last, c.Repeats = text, 1
+	}
+	c.Times = append(c.Times, now)
+	for len(c.Times) > 0 && now.Sub(c.Times[0]) > pol.window {
+		c.Times = c.Times[1:]
+	}
+	reason := ""
+	switch {
+	case pol.words != nil && pol.words.MatchString(text):
+		reason = "language"
+	case pol.Repeat > 1 && c.Repeats >= pol.Repeat:
+		reason = "repeating messages"
+		c.Repeats = 0
+	case pol.Flood > 1 && len(c.Times) >= pol.Flood:
+		reason = "flooding chat"
+		c.Times = nil
+	case pol.shouting(text):
+		reason = "shouting"
+	default:
+		for _, re := range pol.patterns {
+			if re.MatchString(text) {
+				reason = "language"
+				break
+			}
+		}
+	}
+	if reason == "" {
+		return now.After(c.Muted)
+	}
+	t.penalize(id, reason, text)
+	return false
+}
+
+//active returns the number of strikes in r within the strike window at now.
+func (f *filterPolicy) active(r strikeRecord, now time.Time) (n int) {
+	for _, s := range r.Strikes {
+		if f.strikeWindow <= 0 || now.Sub(s.Time) < f.strikeWindow {
+			n++
+		}
+	}
+	return
+}
+
+//penalize records a strike for the player in slot id & applies the penalty for
+//their count of recent strikes.
+func (t *Tracker) penalize(id int, reason, text string) {
+	pol := &t.filter
+	p := &t.players[id]
+	now := time.Now()
+	count := 0
+	if p.key() != "" {
+		count = pol.active(t.strikes[p.key()], now)
+	}
+	penalty := "warn"
+	if n := len(pol.Penalties); n > 0 {
+		i := count
+		if i >= n {
+			i = n - 1
+		}
+		penalty = pol.Penalties[i]
+	}
+	if p.key() != "" {
+		r := t.strikes[p.key()]
+		r.Name = p.Name
+		r.Strikes = append(r.Strikes, strike{Time: now, Reason: reason, Penalty: penalty, Text: text})
+		t.strikes[p.key()] = r
+		if err := writeJSON(t.path("strikes.json"), &t.strikes); err != nil {
+			fmt.Println(err)
+		}
+	}
+	n := count + 1
+	t.moderated("strike", p, "", reason, fmt.Sprintf("STRIKE %d: %s (%s) - %s\n", n, p.Name, reason, penalty))
+	switch penalty {
+	case "mute":
+		t.chatters[id].Muted = time.Now().Add(pol.mute)
+		t.private(id, fmt.Sprintf("Strike %d (%s): you are muted for %s", n, reason, pol.mute))
+	case "kick":
+		t.kick(id, fmt.Sprintf("strike %d (%s)", n, reason))
+	case "tempban":
+		if err := t.addBan(id, "filter", fmt.Sprintf("strike %d (%s)", n, reason), pol.tempban); err != nil {
+			t.kick(id, fmt.Sprintf("strike %d (%s)", n, reason))
+		}
+	default:
+		t.private(id, fmt.Sprintf("Warning - strike %d (%s)", n, reason))
+	}
+}
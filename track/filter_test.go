@@ -0,0 +1,43 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+filter tests check which strikes count towards a penalty.
+*/
+
+//
+package track
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActiveStrikes(t *testing.T) {
+	now := time.Now()
+	r := strikeRecord{Strikes: []strike{
+		{Time: now.Add(-90 * 24 * time.Hour)},
+		{Time: now.Add(-8 * 24 * time.Hour)},
+		{Time: now.Add(-6 * 24 * time.Hour)},
+		{Time: now.Add(-time.Minute)},
+	}}
+	tests := map[string]int{"7d": 2, "30d": 3, "1h": 1, "": 2, "0": 4}
+	for window, want := range tests {
+		f := defaultFilterPolicy()
+		f.StrikeWindow = window
+		if err := f.compile(); err != nil {
+			t.Fatal(err)
+		}
+		if got := f.active(r, now); got != want {
+			t.Errorf("window %q: %d active strikes, want %d", window, got, want)
+		}
+	}
+	f := defaultFilterPolicy()
+	f.StrikeWindow = "soon"
+	if f.compile() == nil {
+		t.Error("bad StrikeWindow compiled")
+	}
+}
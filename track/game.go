@@ -11,7 +11,6 @@ gorcon/track (lee8oi)
 package track
 
 import (
-	"fmt"
 	"strings"
 )
 
@@ -47,9 +46,6 @@ func (g *game) update(data string) {
 			Elapsed:   splitLine[18],
 			Remaining: splitLine[19],
 		}
-		if err := writeJSON("game.json", g); err != nil {
-			fmt.Println(err)
-		}
 	}
 }
 
@@ -0,0 +1,179 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+identity methods remember every name used by a nucleus (or profile) id, to spot
+players returning under new names. Identities are kept with the visits in
+'seen.json'.
+*/
+
+//
+package track
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+//whoisShown is the number of identities listed by the whois command.
+const whoisShown = 3
+
+//usedName is a name seen for an identity.
+type usedName struct {
+	Name, Clan  string
+	First, Last time.Time
+	Visits      int
+}
+
+//Identity is a nucleus (or profile) id with its visits & names.
+type Identity struct {
+	ID string
+	sighting
+}
+
+//sight records a visit by p under their current name.
+func (t *Tracker) sight(p *player) (s sighting, known bool) {
+	s, known, _ = t.see(p, true)
+	t.saveSeen()
+	return
+}
+
+/*
+see updates the identity of p: when it was last seen & the names used. A visit (or
+the first sighting of the id) is counted. Changed is true when more than the last
+seen times changed.
+*/
+func (t *Tracker) see(p *player, visit bool) (s sighting, known, changed bool) {
+	s, known = t.seen[p.key()]
+	now := time.Now()
+	if !known {
+		s.First, visit, changed = now, true, true
+	}
+	if len(s.Names) == 0 && s.Name != "" { //recorded before names were kept
+		s.Names = []usedName{{Name: s.Name, Clan: t.clanOf(s.Name), First: s.First, Last: s.Last, Visits: s.Visits}}
+	}
+	found := false
+	for i := range s.Names {
+		if s.Names[i].Name == p.Name {
+			s.Names[i].Last = now
+			if visit {
+				s.Names[i].Visits++
+			}
+			found = true
+		}
+	}
+	if !found {
+		s.Names = append(s.Names, usedName{Name: p.Name, Clan: t.clanOf(p.Name), First: now, Last: now, Visits: 1})
+		changed = true
+	}
+	s.Name = p.Name
+	s.Profileid = p.Profileid
+	s.Last = now
+	if visit {
+		s.Visits++
+		changed = true
+	}
+	t.seen[p.key()] = s
+	return
+}
+
+//seeAll updates the identities of every player on the server, including those
+//already on when the Tracker started. 'seen.json' is written when more than the
+//last seen times changed, otherwise at most once a minute.
+func (t *Tracker) seeAll() {
+	changed := false
+	for key := range t.players {
+		p := &t.players[key]
+		if p.Name == "" || p.key() == "" {
+			continue
+		}
+		if _, _, c := t.see(p, false); c {
+			changed = true
+		}
+	}
+	if changed || time.Since(t.seenSaved) >= time.Minute {
+		t.saveSeen()
+	}
+}
+
+//saveSeen writes 'seen.json'.
+func (t *Tracker) saveSeen() {
+	t.seenSaved = time.Now()
+	if err := writeJSON(t.path("seen.json"), &t.seen); err != nil {
+		fmt.Println(err)
+	}
+}
+
+//lookup returns the identities whose id or profile id is q, or who used a name
+//containing q, most recently seen first.
+func (t *Tracker) lookup(q string) (list []Identity) {
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return
+	}
+	lower := strings.ToLower(q)
+	for id, s := range t.seen {
+		match := id == q || s.Profileid == q || strings.Contains(strings.ToLower(s.Name), lower)
+		for _, n := range s.Names {
+			match = match || strings.Contains(strings.ToLower(n.Name), lower)
+		}
+		if match {
+			list = append(list, Identity{ID: id, sighting: s})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Last.After(list[j].Last) })
+	return
+}
+
+//Whois returns the identities matching q: an id, profile id or part of a name.
+func (t *Tracker) Whois(q string) []Identity {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lookup(q)
+}
+
+//whoisCmd handles the in-game 'whois <player|id|name>' command. Connected players
+//are found as usual, anyone else by id or any name they used.
+func (t *Tracker) whoisCmd(id int, args []string) {
+	if len(args) == 0 {
+		t.private(id, "usage: whois <player|id|name>")
+		return
+	}
+	var list []Identity
+	if found, fuzzy := t.resolve(id, args[0]); len(found) == 1 && !fuzzy {
+		p := &t.players[found[0]]
+		if s, ok := t.seen[p.key()]; ok {
+			list = []Identity{{ID: p.key(), sighting: s}}
+		}
+	}
+	if list == nil {
+		list = t.lookup(strings.Join(args, " "))
+	}
+	if len(list) == 0 {
+		t.private(id, fmt.Sprintf("nobody found ('%s')", strings.Join(args, " ")))
+		return
+	}
+	for i, s := range list {
+		if i == whoisShown {
+			t.private(id, fmt.Sprintf("...and %d more", len(list)-whoisShown))
+			break
+		}
+		var names []string
+		for _, n := range s.Names {
+			if n.Name != s.Name {
+				names = append(names, n.Name)
+			}
+		}
+		text := fmt.Sprintf("%s (%s): %d visits, first %s, last %s", s.Name, s.ID, s.Visits,
+			s.First.Format("2006-01-02"), s.Last.Format("2006-01-02 15:04"))
+		if len(names) > 0 {
+			text += ", also " + strings.Join(names, ", ")
+		}
+		t.private(id, text)
+	}
+}
@@ -0,0 +1,42 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+identity tests check how players are recorded in 'seen.json'.
+*/
+
+//
+package track
+
+import (
+	"testing"
+	"time"
+)
+
+//TestSeeAll checks that players already online are recorded once & kept up to date.
+func TestSeeAll(t *testing.T) {
+	tr, _ := testTracker(t)
+	players(tr)
+	tr.seeAll()
+	first := tr.seen["1001"]
+	if first.Visits != 1 || first.Name != "Bob" || len(tr.seen) != 2 {
+		t.Fatalf("after the first update: %+v (%d ids)", first, len(tr.seen))
+	}
+	time.Sleep(10 * time.Millisecond)
+	tr.seeAll()
+	s := tr.seen["1001"]
+	if s.Visits != 1 || !s.Last.After(first.Last) || !s.First.Equal(first.First) {
+		t.Errorf("after the second update: %+v", s)
+	}
+	if s, _ = tr.sight(&tr.players[1]); s.Visits != 2 || s.Names[0].Visits != 2 {
+		t.Errorf("after a new visit: %+v", s)
+	}
+	tr.players[1].Name = "=ABC=Bob"
+	tr.seeAll()
+	if s = tr.seen["1001"]; s.Visits != 2 || len(s.Names) != 2 || s.Names[1].Clan != "ABC" {
+		t.Errorf("after a name change: %+v", s)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+idle methods are used to warn & kick idle players. The policy is kept in
+'idle.json'.
+*/
+
+//
+package track
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+/*
+idlePolicy configures the idle kicker.
+
+	Warnings   - idle seconds at which a private warning is sent.
+	Kick       - idle seconds at which the player is kicked.
+	MinPlayers - only act when at least this many players are on the server.
+	Exempt     - roles that are never warned or kicked.
+*/
+type idlePolicy struct {
+	Enabled    bool
+	Warnings   []int
+	Kick       int
+	MinPlayers int
+	Exempt     []string
+}
+
+//idleState tracks the warnings given to the player in a slot.
+type idleState struct {
+	Name   string
+	Warned int
+}
+
+//defaultIdlePolicy returns the policy used when 'idle.json' does not exist.
+func defaultIdlePolicy() idlePolicy {
+	return idlePolicy{
+		Warnings:   []int{120, 240},
+		Kick:       300,
+		MinPlayers: 12,
+		Exempt:     []string{"vip", "trial", "moderator", "admin", "owner"},
+	}
+}
+
+//count returns the number of occupied player slots.
+func (pl *playerList) count() (n int) {
+	for i := range pl {
+		if pl[i].Name != "" {
+			n++
+		}
+	}
+	return
+}
+
+//exempt returns true if the player in slot id holds any of the listed roles.
+func (t *Tracker) exempt(id int, roles []string) bool {
+	for _, r := range roles {
+		if t.hasRole(id, r) {
+			return true
+		}
+	}
+	return false
+}
+
+//idleWarning returns the warning for a player idle for idle seconds, with the time
+//left until they are kicked at kick seconds (0 when nobody is kicked).
+func idleWarning(idle, kick int) string {
+	text := fmt.Sprintf("Warning: you have been idle for %s", time.Duration(idle)*time.Second)
+	if left := kick - idle; kick > 0 && left > 0 {
+		text += fmt.Sprintf(" & will be kicked in %s", time.Duration(left)*time.Second)
+	}
+	return text
+}
+
+//idleCheck warns & kicks idle players according to the idle policy. Runs after
+//each player list update.
+func (t *Tracker) idleCheck() {
+	pol := &t.idle
+	if !pol.Enabled {
+		return
+	}
+	count, err := strconv.Atoi(t.game.Players)
+	if err != nil {
+		count = t.players.count()
+	}
+	for key := range t.players {
+		p := &t.players[key]
+		state := t.idlers[key]
+		if state.Name != p.Name {
+			state = idleState{Name: p.Name}
+		}
+		idle, _ := strconv.Atoi(p.Idle)
+		if p.Name == "" || p.Connected != "1" || count < pol.MinPlayers || t.exempt(key, pol.Exempt) {
+			state.Warned = 0
+			t.idlers[key] = state
+			continue
+		}
+		switch {
+		case pol.Kick > 0 && idle >= pol.Kick:
+			if time.Since(t.kicked[key]) < kickWait {
+				break
+			}
+			t.moderated("idle kick", p, "", fmt.Sprintf("idle for %d seconds", idle), fmt.Sprintf("IDLE KICK: %s (%ds idle)\n", p.Name, idle))
+			t.kick(key, fmt.Sprintf("idle for %d seconds", idle))
+			state.Warned = 0
+		case state.Warned < len(pol.Warnings) && idle >= pol.Warnings[state.Warned]:
+			state.Warned++
+			t.moderated("idle warning", p, "", fmt.Sprintf("idle for %d seconds", idle), fmt.Sprintf("IDLE WARNING %d: %s (%ds idle)\n", state.Warned, p.Name, idle))
+			t.private(key, idleWarning(idle, pol.Kick))
+		case len(pol.Warnings) > 0 && idle < pol.Warnings[0]:
+			state.Warned = 0
+		}
+		t.idlers[key] = state
+	}
+}
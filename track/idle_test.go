@@ -0,0 +1,30 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+idle tests check the warnings sent to idle players.
+*/
+
+//
+package track
+
+import "testing"
+
+func TestIdleWarning(t *testing.T) {
+	tests := []struct {
+		idle, kick int
+		want       string
+	}{
+		{120, 300, "Warning: you have been idle for 2m0s & will be kicked in 3m0s"},
+		{250, 300, "Warning: you have been idle for 4m10s & will be kicked in 50s"},
+		{120, 0, "Warning: you have been idle for 2m0s"},
+	}
+	for _, test := range tests {
+		if got := idleWarning(test.idle, test.kick); got != test.want {
+			t.Errorf("idle %d, kick %d: got %q, want %q", test.idle, test.kick, got, test.want)
+		}
+	}
+}
@@ -22,25 +22,69 @@ import (
 	"github.com/lee8oi/gorcon"
 	"github.com/lee8oi/gorcon/log"
 	"io/ioutil"
+	"path/filepath"
 	//"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 )
 
+//Log receives text lines that are not Tracker events. Log & Publish default to a
+//log web server on :23456 started by the first Tracker.
 var Log func(string)
 
+var web sync.Once
+
 type Tracker struct {
-	players playerList
-	aliases map[string]alias
-	admins  map[string]admin
+	players   playerList
+	aliases   map[string]alias
+	admins    map[string]admin
+	perms     permissions
+	templates map[string]*template.Template
+	choices   map[int]choice
+	bans      banList
+	kicked    map[int]time.Time
+	idle      idlePolicy
+	idlers    [16]idleState
+	ping      pingPolicy
+	pingers   [16]pingState
+	balance   balancePolicy
+	balanced  time.Time
+	filter    filterPolicy
+	chatters  [16]chatter
+	strikes   map[string]strikeRecord
+	schedule  schedule
+	welcomes  welcomePolicy
+	seen      map[string]sighting
+	seenSaved time.Time //when 'seen.json' was last written
+	archive   archivePolicy
+	archived  string //day of the current archive file
+	notifier  notifyPolicy
+	relay     relayPolicy
+	clans     clanPolicy
+	clanStats clanStats
+	matches   matchPolicy
+	round     map[string]roundEntry //players' best scores this round
+	match     *matchState
+	link      string //"up" or "down" once the rcon connection has been watched
+	chat      []message
+	mu        sync.Mutex //guards tracker state shared with other goroutines
+	quit      chan struct{}
+	updated   time.Time
+	health    atomic.Value //healthState, so Health doesn't need t.mu
 	//proc    chan process
 	game game
 	Rcon gorcon.Rcon
+	ID   string //server id used to select per-server role overrides
+	Dir  string //directory holding the data files, defaults to the current directory
 }
 
 type admin struct {
 	Power int
 	Name  string
+	Roles []string
 }
 
 type alias struct {
@@ -60,78 +104,349 @@ func (t *Tracker) Start(wait string) {
 		fmt.Println(err)
 		return
 	}
-	Log = log.H.Log
+	web.Do(startWeb)
+	t.mu.Lock() //Reload & the status methods may already be called
+	t.choices = make(map[int]choice)
+	t.kicked = make(map[int]time.Time)
+	loadJSON(t.path("players.json"), &t.players)
+	loadJSON(t.path("game.json"), &t.game)
+	loadJSON(t.path("clanstats.json"), &t.clanStats)
+	if t.clanStats.Clans == nil {
+		t.clanStats.Clans = make(map[string]*clanRecord)
+	}
+	t.round = make(map[string]roundEntry)
+	t.load()
+	t.keepHealth()
+	t.mu.Unlock()
 	go t.Rcon.Init()
 	go t.Rcon.Handler(t.handle)
-	go log.Start()
+	go t.announcer()
+	go t.watcher(time.Second)
 	t.Rcon.Enqueue("bf2cc monitor 1")
 	t.Rcon.Enqueue("bf2cc setadminname Gorcon")
+	quit := t.stopper()
+	for {
+		t.Rcon.Enqueue("bf2cc si")
+		t.Rcon.Enqueue("bf2cc pl")
+		t.Rcon.Enqueue("bf2cc clientchatbuffer")
+		//t.Log("testing iteration")
+		select {
+		case <-quit:
+			return
+		case <-time.After(dur):
+		}
+	}
+}
 
-	loadJSON("players.json", &t.players)
-	loadJSON("game.json", &t.game)
-	if err := loadJSON("admins.json", &t.admins); err != nil {
+//startWeb starts the default log web server unless Log & Publish were set.
+func startWeb() {
+	if Log != nil && Publish != nil {
+		return
+	}
+	logf, publish := func(s string) { fmt.Print(s) }, func(m log.Message) { fmt.Print(m.Text) }
+	if s, err := log.New(log.Options{}); err != nil {
+		fmt.Println(err)
+	} else {
+		go func() {
+			if err := s.ListenAndServe(); err != nil {
+				fmt.Println(err)
+			}
+		}()
+		logf, publish = s.Log, s.Publish
+	}
+	if Log == nil {
+		Log = logf
+	}
+	if Publish == nil {
+		Publish = publish
+	}
+}
+
+//load reads the tracker configuration files, writing defaults for any that are
+//missing.
+func (t *Tracker) load() {
+	if t.seen != nil { //keep the last seen times not written yet
+		t.saveSeen()
+	}
+	t.admins, t.bans, t.aliases, t.strikes, t.seen = nil, nil, nil, nil, nil
+	t.perms, t.schedule = permissions{}, schedule{}
+	t.idle, t.ping, t.balance = idlePolicy{}, pingPolicy{}, balancePolicy{}
+	t.filter, t.welcomes, t.archive = filterPolicy{}, welcomePolicy{}, archivePolicy{}
+	t.notifier.stop()
+	t.relay.stop()
+	t.notifier, t.relay, t.clans = notifyPolicy{}, relayPolicy{}, clanPolicy{}
+	if err := loadJSON(t.path("admins.json"), &t.admins); err != nil {
 		t.admins = make(map[string]admin)
-		t.admins["2318009192"] = admin{Power: 100, Name: "Vegabruda"}
-		if err := writeJSON("admins.json", &t.admins); err != nil {
+		t.admins["2318009192"] = admin{Power: 100, Name: "Vegabruda", Roles: []string{"owner"}}
+		if err := writeJSON(t.path("admins.json"), &t.admins); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if err := loadJSON(t.path("bans.json"), &t.bans); err != nil {
+		t.bans = make(banList)
+	}
+	if err := loadJSON(t.path("idle.json"), &t.idle); err != nil {
+		t.idle = defaultIdlePolicy()
+		if err := writeJSON(t.path("idle.json"), &t.idle); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if err := loadJSON(t.path("ping.json"), &t.ping); err != nil {
+		t.ping = defaultPingPolicy()
+		if err := writeJSON(t.path("ping.json"), &t.ping); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if err := loadJSON(t.path("balance.json"), &t.balance); err != nil {
+		t.balance = defaultBalancePolicy()
+		if err := writeJSON(t.path("balance.json"), &t.balance); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if err := t.balance.compile(); err != nil {
+		fmt.Println("balance.json:", err)
+		t.balance.Enabled = false
+	}
+	if err := loadJSON(t.path("filter.json"), &t.filter); err != nil {
+		t.filter = defaultFilterPolicy()
+		if err := writeJSON(t.path("filter.json"), &t.filter); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if err := t.filter.compile(); err != nil {
+		fmt.Println("filter.json:", err)
+		t.filter.Enabled = false
+	}
+	if err := loadJSON(t.path("strikes.json"), &t.strikes); err != nil {
+		t.strikes = make(map[string]strikeRecord)
+	}
+	if err := loadJSON(t.path("schedule.json"), &t.schedule); err != nil {
+		t.schedule = defaultSchedule()
+		if err := writeJSON(t.path("schedule.json"), &t.schedule); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if err := t.schedule.compile(); err != nil {
+		fmt.Println("schedule.json:", err)
+		t.schedule = schedule{}
+	}
+	if err := loadJSON(t.path("welcome.json"), &t.welcomes); err != nil {
+		t.welcomes = defaultWelcomePolicy()
+		if err := writeJSON(t.path("welcome.json"), &t.welcomes); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if err := t.welcomes.compile(); err != nil {
+		fmt.Println("welcome.json:", err)
+		t.welcomes.Enabled = false
+	}
+	if err := loadJSON(t.path("archive.json"), &t.archive); err != nil {
+		t.archive = defaultArchivePolicy()
+		if err := writeJSON(t.path("archive.json"), &t.archive); err != nil {
+			fmt.Println(err)
+		}
+	}
+	t.archived = ""
+	if err := loadJSON(t.path("notify.json"), &t.notifier); err != nil {
+		t.notifier = defaultNotifyPolicy()
+		if err := writeJSON(t.path("notify.json"), &t.notifier); err != nil {
 			fmt.Println(err)
 		}
 	}
-	if err := loadJSON("aliases.json", &t.aliases); err != nil {
+	if err := t.notifier.compile(); err != nil {
+		fmt.Println("notify.json:", err)
+		t.notifier.Enabled = false
+	}
+	t.notifier.start()
+	if err := loadJSON(t.path("clans.json"), &t.clans); err != nil {
+		t.clans = defaultClanPolicy()
+		if err := writeJSON(t.path("clans.json"), &t.clans); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if err := t.clans.compile(); err != nil {
+		fmt.Println("clans.json:", err)
+		t.clans.patterns = nil
+	}
+	if err := loadJSON(t.path("matches.json"), &t.matches); err != nil {
+		t.matches = defaultMatchPolicy()
+		if err := writeJSON(t.path("matches.json"), &t.matches); err != nil {
+			fmt.Println(err)
+		}
+	}
+	for name, c := range t.matches.Formats {
+		if err := c.check(); err != nil {
+			fmt.Println("matches.json:", name, err)
+			delete(t.matches.Formats, name)
+		}
+	}
+	if err := loadJSON(t.path("relay.json"), &t.relay); err != nil {
+		t.relay = defaultRelayPolicy()
+		if err := writeJSON(t.path("relay.json"), &t.relay); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if err := t.relay.compile(); err != nil {
+		fmt.Println("relay.json:", err)
+		t.relay.Enabled = false
+	}
+	t.startRelay()
+	if err := loadJSON(t.path("seen.json"), &t.seen); err != nil {
+		t.seen = make(map[string]sighting)
+	}
+	if err := loadJSON(t.path("roles.json"), &t.perms); err != nil {
+		t.perms = defaultPermissions()
+		if err := writeJSON(t.path("roles.json"), &t.perms); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if err := loadJSON(t.path("aliases.json"), &t.aliases); err != nil {
 		t.aliases = make(map[string]alias)
-		t.aliases["say"] = alias{Power: 100, Visibility: "public", Message: ""}
-		t.aliases["self"] = alias{Power: 0, Visibility: "private", Message: "$PN$ $PT$ $PL$ $PTN$ enemy: $ET$"}
-		t.aliases["test"] = alias{Power: 100, Visibility: "private", Message: "testing successful"}
-		t.aliases["toot"] = alias{Power: 0, Visibility: "public", Message: "$PN$ bites his lip and farts out the word *$PT$*"}
-		t.aliases["kick"] = alias{Power: 100, Visibility: "server", Message: "kick"}
-		t.aliases["ban"] = alias{Power: 100, Visibility: "server", Message: "ban"}
-		t.aliases["tacos"] = alias{Power: 0, Visibility: "public", Message: "We only use the finest cuts of $ET$ found on the battlefield. These delicious tacos are for the $PT$ by the $PT$!"}
-		t.aliases["pizza"] = alias{Power: 0, Visibility: "public", Message: "Only the freshest cuts of $ET$ meat go into our fine $PT$ deep dish pizzas!"}
-		t.aliases["beer"] = alias{Power: 0, Visibility: "public", Message: "$PT$ have some tasty pale ale, but the $ET$'s are using them for target practice."}
-		t.aliases["bacon"] = alias{Power: 0, Visibility: "public", Message: "Thinly sliced $ET$'s make the best bacon. Try it for yourself!"}
-		t.aliases["rawr"] = alias{Power: 0, Visibility: "public", Message: "$PN$ howls out a thunderous battle cry."}
-		t.aliases["joint"] = alias{Power: 0, Visibility: "public", Message: "Puff puff pass some of this wicked stuff from our private stash!"}
-		t.aliases["cake"] = alias{Power: 0, Visibility: "public", Message: "The $PN$'s have ordered a cake for the $ET$'s! Filled with explosives."}
-		t.aliases["panic"] = alias{Power: 0, Visibility: "public", Message: "$PN$ panics and starts screaming hysterically."}
-		t.aliases["rage"] = alias{Power: 0, Visibility: "public", Message: "$PN$ gets mad an starts screaming like a maniac."}
-		t.aliases["meow"] = alias{Power: 0, Visibility: "public", Message: "$PN$ lets out a scrappy alley cat meow."}
-		t.aliases["fart"] = alias{Power: 0, Visibility: "public", Message: "$PN$ bites lip and lets out a horrendous grass-wilting fart."}
-		t.aliases["complaint"] = alias{Power: 0, Visibility: "public", Message: "$PN says *heres the complaint department* and points to the exit."}
+		t.aliases["say"] = alias{Power: 100, Visibility: "public", Message: "{{.Line}}"}
+		t.aliases["self"] = alias{Power: 0, Visibility: "private", Message: "{{.Caller.Name}} {{team .Caller}} {{.Caller.Level}} {{size .Game .Caller}} enemy: {{enemy .Caller}}"}
+		t.aliases["test"] = alias{Power: 100, Visibility: "private", Message: "testing successful {{.Line}}"}
+		t.aliases["toot"] = alias{Power: 0, Visibility: "public", Message: "{{.Caller.Name}} bites his lip and farts out the word *{{team .Caller}}*"}
+		t.aliases["tacos"] = alias{Power: 0, Visibility: "public", Message: "We only use the finest cuts of {{enemy .Caller}} found on the battlefield. These delicious tacos are for the {{team .Caller}} by the {{team .Caller}}!"}
+		t.aliases["pizza"] = alias{Power: 0, Visibility: "public", Message: "Only the freshest cuts of {{enemy .Caller}} meat go into our fine {{team .Caller}} deep dish pizzas!"}
+		t.aliases["beer"] = alias{Power: 0, Visibility: "public", Message: "{{team .Caller}} have some tasty pale ale, but the {{enemy .Caller}}'s are using them for target practice."}
+		t.aliases["bacon"] = alias{Power: 0, Visibility: "public", Message: "Thinly sliced {{enemy .Caller}}'s make the best bacon. Try it for yourself!"}
+		t.aliases["rawr"] = alias{Power: 0, Visibility: "public", Message: "{{.Caller.Name}} howls out a thunderous battle cry."}
+		t.aliases["joint"] = alias{Power: 0, Visibility: "public", Message: "Puff puff pass some of this wicked stuff from our private stash!{{if .Line}} {{.Line}}{{end}}"}
+		t.aliases["cake"] = alias{Power: 0, Visibility: "public", Message: "The {{team .Caller}}'s have ordered a cake for the {{enemy .Caller}}'s! Filled with explosives."}
+		t.aliases["panic"] = alias{Power: 0, Visibility: "public", Message: "{{.Caller.Name}} panics and starts screaming hysterically."}
+		t.aliases["rage"] = alias{Power: 0, Visibility: "public", Message: "{{.Caller.Name}} gets mad an starts screaming like a maniac."}
+		t.aliases["meow"] = alias{Power: 0, Visibility: "public", Message: "{{.Caller.Name}} lets out a scrappy alley cat meow."}
+		t.aliases["fart"] = alias{Power: 0, Visibility: "public", Message: "{{.Caller.Name}} bites lip and lets out a horrendous grass-wilting fart."}
+		t.aliases["complaint"] = alias{Power: 0, Visibility: "public", Message: "{{.Caller.Name}} says *heres the complaint department* and points to the exit."}
 		t.aliases["rules"] = alias{Power: 0, Visibility: "public", Message: "Rules: Be respectful. Help your team. No cheating, no whining, no badmouthing, no idling, no t-bagging. no soliciting."}
 		t.aliases["promote"] = alias{Power: 100, Visibility: "server", Message: ""}
 		t.aliases["demote"] = alias{Power: 100, Visibility: "server", Message: ""}
-		t.aliases["info"] = alias{Power: 100, Visibility: "server", Message: "$PN$ Class:$PC$ Lvl:$PL$ Ping:$PING$ $VIP$"}
-		if err := writeJSON("aliases.json", &t.aliases); err != nil {
+		t.aliases["info"] = alias{Power: 100, Visibility: "server", Message: "{{.Target.Name}} Class:{{.Target.Kit}} Lvl:{{.Target.Level}} Ping:{{.Target.Ping}}{{if vip .Target}} VIP{{end}}"}
+		if err := writeJSON(t.path("aliases.json"), &t.aliases); err != nil {
 			fmt.Println(err)
 		}
 	}
-	for {
-		t.Rcon.Enqueue("bf2cc si")
-		t.Rcon.Enqueue("bf2cc pl")
-		t.Rcon.Enqueue("bf2cc clientchatbuffer")
-		//t.Log("testing iteration")
-		time.Sleep(dur)
+	t.compile()
+}
+
+//Reload re-reads the tracker configuration files (admins, roles, aliases, bans &
+//policies) while the Tracker is running.
+func (t *Tracker) Reload() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.load()
+}
+
+//stopper returns the channel closed by Stop.
+func (t *Tracker) stopper() chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.quit == nil {
+		t.quit = make(chan struct{})
 	}
+	return t.quit
+}
+
+//Stop ends the Tracker loop, saves the player list & game state (if any data was
+//received) and closes the Rcon connection.
+func (t *Tracker) Stop() {
+	quit := t.stopper()
+	t.mu.Lock()
+	select {
+	case <-quit:
+	default:
+		close(quit)
+	}
+	if !t.updated.IsZero() {
+		t.save()
+	}
+	t.notifier.stop()
+	t.relay.stop()
+	if t.clanStats.Clans != nil {
+		t.saveClans()
+	}
+	if t.seen != nil {
+		t.saveSeen()
+	}
+	t.mu.Unlock()
+	t.Rcon.Close()
+}
+
+//save writes the player list & game state. Callers must hold t.mu.
+func (t *Tracker) save() {
+	if err := writeJSON(t.path("players.json"), t.players); err != nil {
+		fmt.Println(err)
+	}
+	if err := writeJSON(t.path("game.json"), &t.game); err != nil {
+		fmt.Println(err)
+	}
+}
+
+//healthState is the part of Health kept up to date by handle.
+type healthState struct {
+	updated time.Time
+	players int
+}
+
+//Health returns the Rcon connection status, the last time data was received from
+//the game server and the number of players on it. It doesn't wait for t.mu, so a
+//stuck Tracker can't hold up health reporting.
+func (t *Tracker) Health() (status string, updated time.Time, players int) {
+	h, _ := t.health.Load().(healthState)
+	return t.Rcon.Status(), h.updated, h.players
+}
+
+//keepHealth stores the state returned by Health. Callers must hold t.mu.
+func (t *Tracker) keepHealth() {
+	t.health.Store(healthState{updated: t.updated, players: t.players.count()})
+}
+
+//path returns the location of the named data file in the Tracker's Dir.
+func (t *Tracker) path(name string) string {
+	return filepath.Join(t.Dir, name)
 }
 
 func (t *Tracker) handle(s string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.keepHealth()
+	t.updated = time.Now()
 	typ := identify(&s)
 	switch typ {
 	case "server":
+		last := t.game
 		before := t.game.Players
 		t.game.update(s)
 		after := t.game.Players
 		if before != "0" && after == "0" { //when last player leaves
+			list := t.players
 			t.players.parse(" ")
+			t.playerEvents(&list)
+		}
+		if t.game != last {
+			t.emit("game", t.game, "")
 		}
+		t.gameEvents(last, t.game)
 	case "chat":
 		com := make(chan *message)
 		go parseChat(s, com)
 		t.interpret(com)
 	case "player":
+		list := t.players
 		t.players.parse(s)
-		if err := writeJSON("players.json", t.players); err != nil {
-			fmt.Println(err)
+		t.playerEvents(&list)
+		for key := range t.players {
+			if t.players[key].Connection == "connected" {
+				t.welcome(key)
+			}
 		}
+		t.seeAll()
+		t.enforce()
+		t.idleCheck()
+		t.pingCheck()
+		t.clanCheck()
+		t.balanceCheck()
+		t.save()
 		//t.players.investigate()
 		//case "state", "other", "viplist", "maplist":
 		//	fmt.Println(t)
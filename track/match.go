@@ -0,0 +1,564 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+match methods run competitive matches. Each round starts once every player on both
+sides typed 'ready', round results are taken from the ticket counts, and the final
+report is exported to 'matches/' as JSON & CSV signed with the secret in
+'matches.json'. Clan matches lock the teams to two clans.
+*/
+
+//
+package track
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+//matchMoveWait is the time given to a team switch before a player is moved again.
+const matchMoveWait = 10 * time.Second
+
+//restartRound is the default rcon command restarting the round.
+const restartRound = "exec admin.restartMap"
+
+/*
+matchConfig is a match format started with 'match <name>'.
+
+	Clans   - the two clans playing, teams are locked to them. Empty for open teams.
+	Rounds  - rounds played before the match ends, 0 to play until 'match end'.
+	Maps    - map list indexes played in turn, empty to follow the map rotation.
+	Restart - rcon command restarting the round once both sides are ready.
+*/
+type matchConfig struct {
+	Clans   [2]string
+	Rounds  int
+	Maps    []int
+	Restart string
+}
+
+/*
+matchPolicy is stored in 'matches.json'.
+
+	Secret  - key of the HMAC-SHA256 signing the exported reports.
+	Formats - match formats by name.
+*/
+type matchPolicy struct {
+	Secret  string
+	Formats map[string]matchConfig
+}
+
+//matchReport is the final scoreboard of a match.
+type matchReport struct {
+	Format         string
+	Sides          [2]string
+	Teams          map[string]string //side -> team
+	Started, Ended time.Time
+	Rounds         []clanRound
+	Totals         map[string]clanScore
+	Tickets        map[string]int
+	RoundWins      map[string]int
+	Winner         string //side, "" for a draw
+}
+
+//MatchStatus is the state of a running match, as returned by Tracker.Match.
+type MatchStatus struct {
+	Format  string            //"" for a quick clan match
+	Sides   [2]string         //clans, or team names for open teams
+	Teams   map[string]string //side -> team
+	Locked  bool              //teams are locked to the clans
+	Started time.Time
+	Rounds  []clanRound
+	Phase   string          //"warmup", "restart" or "live"
+	Ready   map[string]bool //player key -> ready
+}
+
+//matchState is a running match.
+type matchState struct {
+	MatchStatus
+	config matchConfig
+	moved  [16]time.Time
+}
+
+//defaultMatchPolicy returns the policy used when 'matches.json' does not exist.
+func defaultMatchPolicy() matchPolicy {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		fmt.Println(err)
+	}
+	return matchPolicy{
+		Secret: hex.EncodeToString(b),
+		Formats: map[string]matchConfig{
+			"bo1": matchConfig{Rounds: 1, Restart: restartRound},
+			"bo3": matchConfig{Rounds: 3, Restart: restartRound},
+		},
+	}
+}
+
+//check returns an error for a format that can't be played.
+func (c *matchConfig) check() error {
+	if (c.Clans[0] == "") != (c.Clans[1] == "") || c.Clans[0] != "" && c.Clans[0] == c.Clans[1] {
+		return fmt.Errorf("two different clans or none are needed")
+	}
+	if c.Rounds < 0 {
+		return fmt.Errorf("negative rounds")
+	}
+	return nil
+}
+
+//sign returns the hex HMAC-SHA256 of b keyed with the secret.
+func (m *matchPolicy) sign(b []byte) string {
+	mac := hmac.New(sha256.New, []byte(m.Secret))
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//side returns the side playing as team, or "".
+func (r *matchReport) side(team string) string {
+	for _, s := range r.Sides {
+		if team != "" && r.Teams[s] == team {
+			return s
+		}
+	}
+	return ""
+}
+
+//tickets returns the tickets side had left at the end of round rd.
+func (r *matchReport) tickets(side string, rd clanRound) int {
+	if r.Teams[side] == "1" {
+		return rd.Ntickets
+	}
+	return rd.Rtickets
+}
+
+//roundLine describes the result of round n.
+func (r *matchReport) roundLine(n int, rd clanRound) string {
+	a, b := r.Sides[0], r.Sides[1]
+	text := fmt.Sprintf("Round %d on %s: %s %d tickets, %d pts - %s %d tickets, %d pts.", n, rd.Map,
+		a, r.tickets(a, rd), rd.Teams[r.Teams[a]].Score, b, r.tickets(b, rd), rd.Teams[r.Teams[b]].Score)
+	if w := r.side(rd.Winner); w != "" {
+		return text + " " + w + " takes the round."
+	}
+	return text + " Draw."
+}
+
+//summary is the chat line announcing a match result.
+func (r *matchReport) summary() string {
+	a, b := r.Sides[0], r.Sides[1]
+	text := fmt.Sprintf("Match over: %s %d rounds, %d tickets - %s %d rounds, %d tickets.",
+		a, r.RoundWins[a], r.Tickets[a], b, r.RoundWins[b], r.Tickets[b])
+	if r.Winner == "" {
+		return text + " It's a draw!"
+	}
+	return text + " " + r.Winner + " wins!"
+}
+
+//csv returns the report as CSV: a row per round followed by the totals.
+func (r *matchReport) csv() []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	head := []string{"round", "map", "ended", "winner"}
+	for _, s := range r.Sides {
+		head = append(head, s+" team", s+" tickets", s+" players", s+" score", s+" kills", s+" deaths")
+	}
+	w.Write(head)
+	for n, rd := range r.Rounds {
+		row := []string{strconv.Itoa(n + 1), rd.Map, rd.Ended.Format(time.RFC3339), r.side(rd.Winner)}
+		for _, s := range r.Sides {
+			sc := rd.Teams[r.Teams[s]]
+			row = append(row, teamName(r.Teams[s]), strconv.Itoa(r.tickets(s, rd)), strconv.Itoa(sc.Players),
+				strconv.Itoa(sc.Score), strconv.Itoa(sc.Kills), strconv.Itoa(sc.Deaths))
+		}
+		w.Write(row)
+	}
+	row := []string{"total", "", r.Ended.Format(time.RFC3339), r.Winner}
+	for _, s := range r.Sides {
+		sc := r.Totals[s]
+		row = append(row, teamName(r.Teams[s]), strconv.Itoa(r.Tickets[s]), strconv.Itoa(sc.Players),
+			strconv.Itoa(sc.Score), strconv.Itoa(sc.Kills), strconv.Itoa(sc.Deaths))
+	}
+	w.Write(row)
+	w.Flush()
+	return buf.Bytes()
+}
+
+//teamName returns the name of team "1" or "2".
+func teamName(team string) string {
+	p := player{Team: team}
+	return p.team()
+}
+
+//lockTeam kicks the player in slot key if their clan is not in the match, or moves
+//them to their clan's team. Players allowed to run matches are never kicked.
+//Returns true if the player was dealt with.
+func (t *Tracker) lockTeam(key int, tag string) bool {
+	m := t.match
+	p := &t.players[key]
+	team, ok := m.Teams[tag]
+	switch {
+	case !ok && t.permitted(key, "match"):
+		return false
+	case !ok:
+		if time.Since(t.kicked[key]) >= kickWait {
+			t.kick(key, fmt.Sprintf("clan match in progress (%s vs %s)", m.Sides[0], m.Sides[1]))
+		}
+		return true
+	case p.Team != team && time.Since(m.moved[key]) >= matchMoveWait:
+		m.moved[key] = time.Now()
+		t.private(key, "Clan match: moving you to your clan's team")
+		t.Rcon.Enqueue(fmt.Sprintf(t.balance.Command, key))
+	}
+	return false
+}
+
+//startMatch starts a match in format c and waits for the sides to be ready.
+func (t *Tracker) startMatch(format string, c matchConfig) {
+	m := &matchState{config: c}
+	m.Format, m.Teams, m.Started = format, make(map[string]string), time.Now()
+	if c.Clans[0] != "" {
+		m.Sides, m.Locked = c.Clans, true
+		count := map[string]int{}
+		for key := range t.players {
+			if p := &t.players[key]; p.Name != "" && t.clanOf(p.Name) == c.Clans[0] {
+				count[p.Team]++
+			}
+		}
+		m.Teams[c.Clans[0]], m.Teams[c.Clans[1]] = "1", "2"
+		if count["2"] > count["1"] {
+			m.Teams[c.Clans[0]], m.Teams[c.Clans[1]] = "2", "1"
+		}
+	} else {
+		m.Sides = [2]string{teamName("1"), teamName("2")}
+		m.Teams[m.Sides[0]], m.Teams[m.Sides[1]] = "1", "2"
+	}
+	t.match = m
+	t.round = make(map[string]roundEntry)
+	text := "Match: " + m.Sides[0] + " vs " + m.Sides[1] + "."
+	if m.Locked {
+		text = fmt.Sprintf("Clan match: %s (%s) vs %s (%s). Teams are locked.",
+			m.Sides[0], teamName(m.Teams[m.Sides[0]]), m.Sides[1], teamName(m.Teams[m.Sides[1]]))
+	}
+	if c.Rounds > 0 {
+		text += fmt.Sprintf(" %d rounds.", c.Rounds)
+	}
+	t.Rcon.Enqueue("bf2cc sendserverchat " + text)
+	status := m.snapshot() //the hub marshals payloads later, in its own goroutine
+	t.emit("match", status, text+"\n")
+	t.notify("match start", text, status)
+	t.warmup()
+}
+
+//warmup waits for both sides to be ready for the next round, changing to the next
+//map of the format first.
+func (t *Tracker) warmup() {
+	m := t.match
+	m.Phase, m.Ready = "warmup", make(map[string]bool)
+	if maps := m.config.Maps; len(maps) > 0 {
+		t.changeMap(maps[len(m.Rounds)%len(maps)])
+	}
+	n := strconv.Itoa(len(m.Rounds) + 1)
+	if m.config.Rounds > 0 {
+		n += " of " + strconv.Itoa(m.config.Rounds)
+	}
+	t.Rcon.Enqueue("bf2cc sendserverchat Warmup for round " + n + ". Type !ready when your team is set.")
+}
+
+//readiness counts the connected players & those ready on each team.
+func (t *Tracker) readiness() (ready, total map[string]int) {
+	ready, total = make(map[string]int), make(map[string]int)
+	for key := range t.players {
+		p := &t.players[key]
+		if p.Name == "" || p.Connected != "1" {
+			continue
+		}
+		total[p.Team]++
+		if t.match.Ready[p.key()] {
+			ready[p.Team]++
+		}
+	}
+	return
+}
+
+//readyCheck restarts the round once every player on both sides is ready.
+func (t *Tracker) readyCheck() {
+	if t.match == nil || t.match.Phase != "warmup" {
+		return
+	}
+	ready, total := t.readiness()
+	for _, team := range []string{"1", "2"} {
+		if total[team] == 0 || ready[team] < total[team] {
+			return
+		}
+	}
+	t.goLive()
+}
+
+//goLive restarts the round that will count for the match.
+func (t *Tracker) goLive() {
+	m := t.match
+	m.Phase = "restart"
+	cmd := m.config.Restart
+	if cmd == "" {
+		cmd = restartRound
+	}
+	t.Rcon.Enqueue(fmt.Sprintf("bf2cc sendserverchat Both sides are ready, restarting for round %d!", len(m.Rounds)+1))
+	t.Rcon.Enqueue(cmd)
+}
+
+//matchRestarted puts the match live once the round restarted. Callers must hold t.mu.
+func (t *Tracker) matchRestarted() {
+	m := t.match
+	if m.Phase != "restart" {
+		return
+	}
+	m.Phase = "live"
+	text := fmt.Sprintf("Round %d is live. Good luck!", len(m.Rounds)+1)
+	t.Rcon.Enqueue("bf2cc sendserverchat " + text)
+	t.emit("match", m.snapshot(), text+"\n")
+}
+
+//matchRound records the result of a live round and ends the match after its last
+//round. Callers must hold t.mu.
+func (t *Tracker) matchRound(r clanRound) {
+	m := t.match
+	m.Rounds = append(m.Rounds, r)
+	rep := t.report()
+	text := rep.roundLine(len(m.Rounds), r)
+	t.Rcon.Enqueue("bf2cc sendserverchat " + text)
+	t.emit("match", r, text+"\n")
+	if m.config.Rounds > 0 && len(m.Rounds) >= m.config.Rounds {
+		t.endMatch()
+		return
+	}
+	t.warmup()
+}
+
+//report returns the final scoreboard of the match, counting the scores of the live
+//round as played so far.
+func (t *Tracker) report() matchReport {
+	m := t.match
+	rep := matchReport{
+		Format:    m.Format,
+		Sides:     m.Sides,
+		Teams:     m.Teams,
+		Started:   m.Started,
+		Ended:     time.Now(),
+		Rounds:    m.Rounds,
+		Totals:    make(map[string]clanScore),
+		Tickets:   make(map[string]int),
+		RoundWins: make(map[string]int),
+	}
+	rounds := m.Rounds
+	if m.Phase == "live" && len(t.round) > 0 {
+		rounds = append(rounds[:len(rounds):len(rounds)], clanRound{Teams: teamboard(t.round)})
+	}
+	for _, r := range rounds {
+		for _, side := range m.Sides {
+			s, tot := r.Teams[m.Teams[side]], rep.Totals[side]
+			tot.Team = m.Teams[side]
+			tot.Players = max2(tot.Players, s.Players)
+			tot.Score += s.Score
+			tot.Kills += s.Kills
+			tot.Deaths += s.Deaths
+			rep.Totals[side] = tot
+		}
+	}
+	for _, r := range m.Rounds {
+		for _, side := range m.Sides {
+			rep.Tickets[side] += rep.tickets(side, r)
+		}
+		if w := rep.side(r.Winner); w != "" {
+			rep.RoundWins[w]++
+		}
+	}
+	a, b := m.Sides[0], m.Sides[1]
+	for _, d := range []int{ //round wins, then tickets, then score
+		rep.RoundWins[a] - rep.RoundWins[b],
+		rep.Tickets[a] - rep.Tickets[b],
+		rep.Totals[a].Score - rep.Totals[b].Score,
+	} {
+		if d > 0 {
+			rep.Winner = a
+			break
+		}
+		if d < 0 {
+			rep.Winner = b
+			break
+		}
+	}
+	return rep
+}
+
+//endMatch reports the final scoreboard, exports it & unlocks the teams.
+func (t *Tracker) endMatch() {
+	rep := t.report()
+	t.match = nil
+	t.clanStats.Matches = append(t.clanStats.Matches, rep)
+	if h := t.clans.History; h > 0 && len(t.clanStats.Matches) > h {
+		t.clanStats.Matches = t.clanStats.Matches[len(t.clanStats.Matches)-h:]
+	}
+	t.saveClans()
+	t.export(&rep)
+	text := rep.summary()
+	t.Rcon.Enqueue("bf2cc sendserverchat " + text)
+	t.emit("match", rep, text+"\n")
+	t.notify("match end", text, rep)
+}
+
+//export writes the report to 'matches/' as JSON & CSV, each with a '.sig' file
+//holding its hex HMAC-SHA256 keyed with the secret in 'matches.json'.
+func (t *Tracker) export(rep *matchReport) {
+	dir := t.path("matches")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Println(err)
+		return
+	}
+	name := rep.Started.Format("2006-01-02-150405")
+	if rep.Format != "" {
+		name += "-" + rep.Format
+	}
+	js, err := json.MarshalIndent(rep, "", "    ")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for ext, b := range map[string][]byte{".json": js, ".csv": rep.csv()} {
+		file := filepath.Join(dir, name+ext)
+		if err := ioutil.WriteFile(file, b, 0644); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if err := ioutil.WriteFile(file+".sig", []byte(t.matches.sign(b)+"\n"), 0644); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+//matchCmd handles the in-game 'match' commands:
+//
+//	match <format>       start a match in a format from 'matches.json'
+//	match <clan> <clan>  start a clan match played until 'match end'
+//	match go             start the round without waiting for everyone to be ready
+//	match end            end the match & export the report
+//	match                the match status
+func (t *Tracker) matchCmd(id int, args []string) {
+	m := t.match
+	switch {
+	case len(args) == 0 || len(args) == 1 && args[0] == "status":
+		if m == nil {
+			t.private(id, "no match running")
+			return
+		}
+		rep := t.report()
+		text := fmt.Sprintf("%s vs %s, %s, round %d: %d-%d", m.Sides[0], m.Sides[1], m.Phase,
+			len(m.Rounds)+1, rep.RoundWins[m.Sides[0]], rep.RoundWins[m.Sides[1]])
+		if m.Phase == "warmup" {
+			ready, total := t.readiness()
+			text += fmt.Sprintf(", ready %d/%d - %d/%d", ready[m.Teams[m.Sides[0]]], total[m.Teams[m.Sides[0]]],
+				ready[m.Teams[m.Sides[1]]], total[m.Teams[m.Sides[1]]])
+		}
+		t.private(id, text)
+		return
+	case len(args) == 1 && (args[0] == "end" || args[0] == "stop"):
+		if m == nil {
+			t.private(id, "no match running")
+			return
+		}
+		t.endMatch()
+		return
+	case len(args) == 1 && args[0] == "go":
+		if m == nil || m.Phase != "warmup" {
+			t.private(id, "no match waiting for players")
+			return
+		}
+		t.goLive()
+		return
+	}
+	if m != nil {
+		t.private(id, fmt.Sprintf("a match is running (%s vs %s), end it first", m.Sides[0], m.Sides[1]))
+		return
+	}
+	switch len(args) {
+	case 1:
+		c, ok := t.matches.Formats[args[0]]
+		if !ok {
+			t.private(id, fmt.Sprintf("unknown match format ('%s')", args[0]))
+			return
+		}
+		t.startMatch(args[0], c)
+	case 2:
+		c := matchConfig{Clans: [2]string{args[0], args[1]}}
+		if err := c.check(); err != nil {
+			t.private(id, err.Error())
+			return
+		}
+		t.startMatch("", c)
+	default:
+		t.private(id, "usage: match <format> | match <clan> <clan> | match go | match end")
+	}
+}
+
+//readyCmd handles the in-game 'ready' & 'unready' commands during a match warmup.
+func (t *Tracker) readyCmd(id int, ready bool) {
+	m := t.match
+	if m == nil || m.Phase != "warmup" {
+		t.private(id, "no match waiting for players")
+		return
+	}
+	p := &t.players[id]
+	if p.key() == "" {
+		return
+	}
+	state := "ready"
+	if ready {
+		m.Ready[p.key()] = true
+	} else {
+		delete(m.Ready, p.key())
+		state = "not ready"
+	}
+	r, total := t.readiness()
+	text := fmt.Sprintf("%s is %s (%s %d/%d - %s %d/%d)", p.Name, state,
+		m.Sides[0], r[m.Teams[m.Sides[0]]], total[m.Teams[m.Sides[0]]],
+		m.Sides[1], r[m.Teams[m.Sides[1]]], total[m.Teams[m.Sides[1]]])
+	t.Rcon.Enqueue("bf2cc sendserverchat " + text)
+	t.readyCheck()
+}
+
+//snapshot returns a copy of the match status that later changes don't touch.
+func (m *matchState) snapshot() *MatchStatus {
+	s := m.MatchStatus
+	s.Rounds = append([]clanRound(nil), m.Rounds...)
+	s.Teams = make(map[string]string)
+	for side, team := range m.Teams {
+		s.Teams[side] = team
+	}
+	s.Ready = make(map[string]bool)
+	for k, v := range m.Ready {
+		s.Ready[k] = v
+	}
+	return &s
+}
+
+//Match returns a copy of the running match, or nil.
+func (t *Tracker) Match() *MatchStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.match == nil {
+		return nil
+	}
+	return t.match.snapshot()
+}
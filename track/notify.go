@@ -0,0 +1,218 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+notify methods post Tracker events to HTTP webhooks (Discord, Slack, Matrix bridges
+and the like). Hooks are kept in 'notify.json'.
+*/
+
+//
+package track
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+//hookQueue is the number of notices a hook holds while it waits to send.
+const hookQueue = 100
+
+//hookRetryWait is the wait before the first retry of a failed post. It doubles with
+//each attempt.
+var hookRetryWait = time.Second
+
+/*
+notifyPolicy lists the webhooks. Each hook has:
+
+	URL         - address the notice is posted to.
+	Events      - events sent to the hook (none sends all): "command" (a command
+	              needing more than the player role was used), "round end", "empty"
+	              (last player left), "down" & "up" (rcon connection lost & back),
+	              and the moderation actions "kick", "ban", "unban", "strike",
+	              "idle kick", "ping kick", "balance"...
+	Template    - request body template. Data: .Event, .Server, .Text, .Time, .Game &
+	              .Data (the event payload). The json function quotes a value.
+	ContentType - request content type.
+	Retries     - attempts after a failed post, with growing waits.
+	PerMinute   - maximum posts per minute (0 for no limit).
+*/
+type notifyPolicy struct {
+	Enabled bool
+	Hooks   []*hook
+}
+
+type hook struct {
+	URL, Template, ContentType string
+	Events                     []string
+	Retries, PerMinute         int
+	tmpl                       *template.Template
+	queue                      chan []byte
+}
+
+//notice is the data given to hook templates.
+type notice struct {
+	Event, Server, Text string
+	Time                time.Time
+	Game                game
+	Data                interface{}
+}
+
+//defaultNotifyPolicy returns the policy used when 'notify.json' does not exist.
+func defaultNotifyPolicy() notifyPolicy {
+	return notifyPolicy{
+		Hooks: []*hook{{
+			URL:         "https://discord.com/api/webhooks/ID/TOKEN",
+			Template:    `{"content": {{json (printf "**%s** %s" .Server .Text)}}}`,
+			ContentType: "application/json",
+			Events:      []string{"command", "ban", "round end", "empty", "down", "up"},
+			Retries:     3,
+			PerMinute:   20,
+		}},
+	}
+}
+
+//compile parses the hook templates.
+func (n *notifyPolicy) compile() error {
+	for i, h := range n.Hooks {
+		tmpl, err := template.New("hook").Funcs(funcs).Parse(h.Template)
+		if err == nil {
+			err = tmpl.Execute(ioutil.Discard, notice{})
+		}
+		if err != nil {
+			return fmt.Errorf("hook %d: %s", i, err)
+		}
+		h.tmpl = tmpl
+		if h.ContentType == "" {
+			h.ContentType = "application/json"
+		}
+	}
+	return nil
+}
+
+//start runs a sender for each hook.
+func (n *notifyPolicy) start() {
+	if !n.Enabled {
+		return
+	}
+	for _, h := range n.Hooks {
+		h.queue = make(chan []byte, hookQueue)
+		go h.sender()
+	}
+}
+
+//stop ends the senders once their queues are sent.
+func (n *notifyPolicy) stop() {
+	for _, h := range n.Hooks {
+		if h.queue != nil {
+			close(h.queue)
+			h.queue = nil
+		}
+	}
+}
+
+//sender posts queued notices, keeping to the rate limit & retrying failures.
+func (h *hook) sender() {
+	client := &http.Client{Timeout: 10 * time.Second}
+	var gap time.Duration
+	if h.PerMinute > 0 {
+		gap = time.Minute / time.Duration(h.PerMinute)
+	}
+	var last time.Time
+	for body := range h.queue {
+		for try := 0; ; try++ {
+			if wait := gap - time.Since(last); wait > 0 {
+				time.Sleep(wait)
+			}
+			last = time.Now()
+			retry, err := h.post(client, body)
+			if err == nil {
+				break
+			}
+			if !retry || try >= h.Retries {
+				fmt.Println("notify:", err)
+				break
+			}
+			time.Sleep(time.Duration(1<<uint(try)) * hookRetryWait)
+		}
+	}
+}
+
+//post sends one notice. Connection & server errors and 429 responses are worth a
+//retry, other failures are not.
+func (h *hook) post(client *http.Client, body []byte) (retry bool, err error) {
+	resp, err := client.Post(h.URL, h.ContentType, bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("%s: %s", h.URL, resp.Status)
+	}
+	return false, nil
+}
+
+//notify queues a notice of the event for each hook that wants it. Notices are
+//dropped when a hook's queue is full.
+func (t *Tracker) notify(event, text string, data interface{}) {
+	if !t.notifier.Enabled {
+		return
+	}
+	n := notice{Event: event, Server: t.ID, Text: text, Time: time.Now(), Game: t.game, Data: data}
+	for _, h := range t.notifier.Hooks {
+		if h.queue == nil || len(h.Events) > 0 && !contains(h.Events, event) {
+			continue
+		}
+		var body bytes.Buffer
+		if err := h.tmpl.Execute(&body, n); err != nil {
+			fmt.Println("notify:", err)
+			continue
+		}
+		select {
+		case h.queue <- body.Bytes():
+		default:
+			fmt.Println("notify: queue full, dropped", event)
+		}
+	}
+}
+
+//watcher runs watch every interval until the Tracker stops. It queues no commands,
+//so it keeps running while Enqueue waits for the connection.
+func (t *Tracker) watcher(every time.Duration) {
+	quit := t.stopper()
+	for {
+		t.watch()
+		select {
+		case <-quit:
+			return
+		case <-time.After(every):
+		}
+	}
+}
+
+//watch sends "down" & "up" notices when the rcon connection is lost & back.
+func (t *Tracker) watch() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status := t.Rcon.Status()
+	link := "down"
+	if status == "authenticated" {
+		link = "up"
+	}
+	switch {
+	case link == t.link:
+	case t.link == "" && link == "up": //first login
+	case link == "up":
+		t.notify("up", "rcon connection is back", nil)
+	default:
+		t.notify("down", fmt.Sprintf("rcon connection lost (%s)", status), nil)
+	}
+	t.link = link
+}
@@ -0,0 +1,174 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+notify tests post notices to a local HTTP stand-in for a webhook.
+*/
+
+//
+package track
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+//post is a request received by the webhook stand-in.
+type post struct {
+	Body, ContentType string
+	At                time.Time
+}
+
+//webhook returns a stand-in answering with the given statuses in turn (200 once
+//they run out), and the requests it receives.
+func webhook(t *testing.T, statuses ...int) (*httptest.Server, <-chan post) {
+	posts := make(chan post, 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		posts <- post{Body: string(b), ContentType: r.Header.Get("Content-Type"), At: time.Now()}
+		if len(statuses) > 0 {
+			w.WriteHeader(statuses[0])
+			statuses = statuses[1:]
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, posts
+}
+
+//notifier returns a Tracker notifying h only.
+func notifier(t *testing.T, h *hook) *Tracker {
+	hookRetryWait = 10 * time.Millisecond
+	tr := &Tracker{ID: "alpha"}
+	tr.notifier = notifyPolicy{Enabled: true, Hooks: []*hook{h}}
+	if err := tr.notifier.compile(); err != nil {
+		t.Fatal(err)
+	}
+	tr.notifier.start()
+	t.Cleanup(tr.notifier.stop)
+	return tr
+}
+
+//received returns the next post, failing after a second.
+func received(t *testing.T, posts <-chan post) post {
+	t.Helper()
+	select {
+	case p := <-posts:
+		return p
+	case <-time.After(time.Second):
+		t.Fatal("no post received")
+	}
+	return post{}
+}
+
+//silent fails if anything is posted within d.
+func silent(t *testing.T, posts <-chan post, d time.Duration) {
+	t.Helper()
+	select {
+	case p := <-posts:
+		t.Fatalf("unexpected post %q", p.Body)
+	case <-time.After(d):
+	}
+}
+
+func TestNotifyTemplate(t *testing.T) {
+	srv, posts := webhook(t)
+	tr := notifier(t, &hook{
+		URL:         srv.URL,
+		Template:    `{"content": {{json (printf "**%s** %s" .Server .Text)}}, "event": {{json .Event}}, "map": {{json .Game.Map}}}`,
+		ContentType: "application/json",
+	})
+	tr.game.Map = "dalian_plant"
+	tr.notify("ban", `Bob banned "for good"`, nil)
+	p := received(t, posts)
+	want := `{"content": "**alpha** Bob banned \"for good\"", "event": "ban", "map": "dalian_plant"}`
+	if p.Body != want {
+		t.Errorf("body = %s, want %s", p.Body, want)
+	}
+	if p.ContentType != "application/json" {
+		t.Errorf("content type = %s", p.ContentType)
+	}
+}
+
+func TestNotifyEvents(t *testing.T) {
+	srv, posts := webhook(t)
+	tr := notifier(t, &hook{URL: srv.URL, Template: "{{.Event}}", Events: []string{"ban", "empty"}})
+	for _, event := range []string{"kick", "ban", "command", "empty", "round end"} {
+		tr.notify(event, "", nil)
+	}
+	for _, want := range []string{"ban", "empty"} {
+		if p := received(t, posts); p.Body != want {
+			t.Errorf("got %s, want %s", p.Body, want)
+		}
+	}
+	silent(t, posts, 100*time.Millisecond)
+}
+
+func TestNotifyRetry(t *testing.T) {
+	tests := []struct {
+		statuses []int
+		retries  int
+		posts    int
+	}{
+		{[]int{500}, 3, 2},
+		{[]int{429, 503}, 3, 3},
+		{[]int{502, 502, 502, 502}, 2, 3},
+		{[]int{400}, 3, 1},
+		{[]int{404}, 3, 1},
+	}
+	for _, test := range tests {
+		srv, posts := webhook(t, test.statuses...)
+		tr := notifier(t, &hook{URL: srv.URL, Template: "{{.Text}}", Retries: test.retries})
+		tr.notify("ban", "once", nil)
+		for i := 0; i < test.posts; i++ {
+			if p := received(t, posts); p.Body != "once" {
+				t.Errorf("%v: body = %s", test.statuses, p.Body)
+			}
+		}
+		silent(t, posts, 200*time.Millisecond)
+	}
+}
+
+func TestNotifyPerMinute(t *testing.T) {
+	srv, posts := webhook(t)
+	tr := notifier(t, &hook{URL: srv.URL, Template: "{{.Text}}", PerMinute: 600})
+	for _, text := range []string{"1", "2", "3"} {
+		tr.notify("ban", text, nil)
+	}
+	var last time.Time
+	for _, want := range []string{"1", "2", "3"} {
+		p := received(t, posts)
+		if p.Body != want {
+			t.Errorf("got %s, want %s", p.Body, want)
+		}
+		if gap := p.At.Sub(last); !last.IsZero() && gap < 90*time.Millisecond {
+			t.Errorf("post %s sent %s after the last, want at least 100ms", want, gap)
+		}
+		last = p.At
+	}
+}
+
+func TestNotifyConnectionDown(t *testing.T) {
+	srv, posts := webhook(t)
+	tr, _ := testTracker(t)
+	tr.notifier = notifyPolicy{Enabled: true, Hooks: []*hook{{URL: srv.URL, Template: "{{.Event}}: {{.Text}}", Events: []string{"down", "up"}}}}
+	if err := tr.notifier.compile(); err != nil {
+		t.Fatal(err)
+	}
+	tr.notifier.start()
+	defer tr.notifier.stop()
+	quit := tr.stopper()
+	defer close(quit)
+	go tr.watcher(10 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond) //first watch sees the connection up
+	tr.Rcon.Close()
+	if p := received(t, posts); p.Body != "down: rcon connection lost (closed)" {
+		t.Errorf("got %q", p.Body)
+	}
+	silent(t, posts, 100*time.Millisecond)
+}
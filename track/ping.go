@@ -0,0 +1,113 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+ping methods are used to warn & kick players with a sustained high ping. The policy
+is kept in 'ping.json'.
+*/
+
+//
+package track
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+/*
+pingPolicy configures the ping watchdog.
+
+	Limit    - highest allowed average ping (ms).
+	Samples  - number of player list updates averaged. The highest sample is left
+	           out so a single spike never counts.
+	Warnings - warnings given before a kick. Each warning starts a fresh window.
+	Exempt   - roles that are never warned or kicked.
+*/
+type pingPolicy struct {
+	Enabled  bool
+	Limit    int
+	Samples  int
+	Warnings int
+	Exempt   []string
+}
+
+//pingState holds the recent ping samples of the player in a slot.
+type pingState struct {
+	Name    string
+	Samples []int
+	Warned  int
+}
+
+//defaultPingPolicy returns the policy used when 'ping.json' does not exist.
+func defaultPingPolicy() pingPolicy {
+	return pingPolicy{
+		Limit:    250,
+		Samples:  60,
+		Warnings: 2,
+		Exempt:   []string{"vip", "trial", "moderator", "admin", "owner"},
+	}
+}
+
+//average returns the mean of the samples with the highest one left out.
+func (s *pingState) average() int {
+	if len(s.Samples) < 2 {
+		return 0
+	}
+	sum, high := 0, 0
+	for _, v := range s.Samples {
+		sum += v
+		if v > high {
+			high = v
+		}
+	}
+	return (sum - high) / (len(s.Samples) - 1)
+}
+
+//pingCheck records each player's ping & acts on sustained high pings. Runs after
+//each player list update.
+func (t *Tracker) pingCheck() {
+	pol := &t.ping
+	if !pol.Enabled || pol.Limit <= 0 || pol.Samples < 2 {
+		return
+	}
+	for key := range t.players {
+		p := &t.players[key]
+		state := &t.pingers[key]
+		if state.Name != p.Name {
+			*state = pingState{Name: p.Name}
+		}
+		ping, err := strconv.Atoi(p.Ping)
+		if p.Name == "" || p.Connected != "1" || err != nil || t.exempt(key, pol.Exempt) {
+			continue
+		}
+		state.Samples = append(state.Samples, ping)
+		if len(state.Samples) > pol.Samples {
+			state.Samples = state.Samples[1:]
+		}
+		if len(state.Samples) < pol.Samples {
+			continue
+		}
+		avg := state.average()
+		if avg <= pol.Limit {
+			state.Warned = 0
+			continue
+		}
+		state.Samples = nil
+		if state.Warned < pol.Warnings {
+			state.Warned++
+			t.moderated("ping warning", p, "", fmt.Sprintf("%dms average", avg), fmt.Sprintf("PING WARNING %d: %s (%dms average)\n", state.Warned, p.Name, avg))
+			t.private(key, fmt.Sprintf("Warning: your ping (%dms) is above the %dms limit", avg, pol.Limit))
+			continue
+		}
+		if time.Since(t.kicked[key]) < kickWait {
+			continue
+		}
+		t.moderated("ping kick", p, "", fmt.Sprintf("%dms average", avg), fmt.Sprintf("PING KICK: %s (%dms average)\n", p.Name, avg))
+		t.kick(key, fmt.Sprintf("ping above %dms", pol.Limit))
+		state.Warned = 0
+	}
+}
@@ -147,28 +147,19 @@ func (pl *playerList) state(key int, p *player) {
 	case pl[key].Connected == "" && p.Connected == "0":
 		s = "initial"
 		//fmt.Sprintf("CONNECTING: %s\n", p.Name)
-		Log(fmt.Sprintf("CONNECTING: %s\n", p.Name))
 	case pl[key].Connected == "0" && p.Connected == "0":
 		s = "connecting"
 	case pl[key].Connected == "0" && p.Connected == "":
 		s = "interrupted"
 		//fmt.Printf("INTERRUPTED: %s\n", pl[key].Name)
-		Log(fmt.Sprintf("INTERRUPTED: %s\n", pl[key].Name))
 	case pl[key].Connected == "0" && p.Connected == "1":
 		s = "connected"
 		//fmt.Printf("CONNECTED: %s\n", p.Name)
-		Log(fmt.Sprintf("CONNECTED: %s\n", p.Name))
 	case pl[key].Connected == "1" && p.Connected == "1":
 		s = "established"
 	case pl[key].Connected == "1" && p.Connected == "":
 		s = "disconnected"
-		if pl[key].Joined.Equal(base) {
-			//fmt.Printf("DISCONNECTED: %s\n", pl[key].Name)
-			Log(fmt.Sprintf("DISCONNECTED: %s\n", pl[key].Name))
-		} else {
-			//fmt.Printf("DISCONNECTED: %s (%s)\n", pl[key].Name, pl[key].playtime())
-			Log(fmt.Sprintf("DISCONNECTED: %s (%s)\n", pl[key].Name, pl[key].playtime()))
-		}
+		//connection changes are published by Tracker.playerEvents
 	case pl[key].Connected == "1" && p.Connected == "0":
 		s = "reconnecting"
 	}
@@ -304,16 +295,6 @@ func (pl *playerList) update(key int, p *player) {
 	pl[key] = *p
 }
 
-func (pl *playerList) find(term string) []int {
-	var results []int
-	for key := range pl {
-		if strings.Contains(strings.ToLower(pl[key].Name), strings.ToLower(term)) {
-			results = append(results, key)
-		}
-	}
-	return results
-}
-
 type crime struct {
 	killers, assistants, victims, suicides []*player
 }
@@ -0,0 +1,367 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+relay methods mirror in-game chat to an external channel and bring that channel's
+messages into the game. The relay is configured in 'relay.json'.
+
+In "tcp" mode the Tracker connects to Address and exchanges one message per line,
+"name: text" in both directions. In "webhook" mode chat is posted to Hook and
+messages come back through Tracker.Relay (the API's /relay endpoint).
+*/
+
+//
+package track
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+//relayRecent is the number of relayed lines remembered to spot echoes.
+const relayRecent = 20
+
+/*
+relayPolicy configures the chat relay.
+
+	Mode      - "tcp" or "webhook".
+	Address   - tcp: host:port of the line server.
+	Hook      - webhook: where chat is posted (see notify.json hooks). Templates get
+	            .Server, .Name, .Team, .Type & .Text.
+	Channels  - chat types sent out ("Global", "Team"...; none for all).
+	Out       - tcp: template of the lines sent out.
+	In        - template of the in-game line for an external message (.Name & .Text).
+	PerMinute - external messages & commands let in per minute (0 for no limit).
+	MaxLength - external messages are cut to this many bytes (0 for no limit).
+	Commands  - commands external users may run (e.g. "players" for "!players"):
+	            "players", "status" or an alias. Replies go back to the channel.
+*/
+type relayPolicy struct {
+	Enabled              bool
+	Mode, Address        string
+	Hook                 *hook
+	Channels             []string
+	Out, In              string
+	PerMinute, MaxLength int
+	Commands             []string
+	out, in              *template.Template
+	lines                chan string
+	quit                 chan struct{}
+	recent               []string    //lines relayed lately, in & out
+	let                  []time.Time //when external messages were let in
+	chat                 []string    //lines let in, sent once t.mu is released
+}
+
+//relayed is the data given to relay templates.
+type relayed struct {
+	Server, Name, Team, Type, Text string
+}
+
+//defaultRelayPolicy returns the policy used when 'relay.json' does not exist.
+func defaultRelayPolicy() relayPolicy {
+	return relayPolicy{
+		Mode:      "tcp",
+		Address:   "127.0.0.1:6700",
+		Channels:  []string{"Global"},
+		Out:       "{{.Name}}: {{.Text}}",
+		In:        "[chat] {{.Name}}: {{.Text}}",
+		PerMinute: 10,
+		MaxLength: 120,
+		Commands:  []string{"players", "status"},
+	}
+}
+
+//compile parses the relay templates.
+func (r *relayPolicy) compile() (err error) {
+	switch r.Mode {
+	case "tcp":
+	case "webhook":
+		if r.Hook == nil {
+			return errors.New("webhook mode needs a Hook")
+		}
+		if r.Hook.tmpl, err = template.New("hook").Funcs(funcs).Parse(r.Hook.Template); err != nil {
+			return
+		}
+		if err = r.Hook.tmpl.Execute(ioutil.Discard, relayed{}); err != nil {
+			return
+		}
+		if r.Hook.ContentType == "" {
+			r.Hook.ContentType = "application/json"
+		}
+	default:
+		return fmt.Errorf("unknown mode '%s'", r.Mode)
+	}
+	for _, t := range []struct {
+		to   **template.Template
+		text string
+	}{{&r.out, r.Out}, {&r.in, r.In}} {
+		if *t.to, err = template.New("relay").Funcs(funcs).Parse(t.text); err != nil {
+			return
+		}
+		if err = (*t.to).Execute(ioutil.Discard, relayed{}); err != nil {
+			return
+		}
+	}
+	return
+}
+
+//startRelay connects the relay.
+func (t *Tracker) startRelay() {
+	r := &t.relay
+	if !r.Enabled {
+		return
+	}
+	r.quit = make(chan struct{})
+	if r.Mode == "webhook" {
+		r.Hook.queue = make(chan []byte, hookQueue)
+		go r.Hook.sender()
+		return
+	}
+	r.lines = make(chan string, hookQueue)
+	go t.relayConn(r.Address, r.lines, r.quit)
+}
+
+//stop disconnects the relay.
+func (r *relayPolicy) stop() {
+	if r.quit != nil {
+		close(r.quit)
+		r.quit = nil
+	}
+	if r.Hook != nil && r.Hook.queue != nil {
+		close(r.Hook.queue)
+		r.Hook.queue = nil
+	}
+}
+
+//relayConn keeps the tcp connection up, sending lines & passing received ones to
+//relayLine, until quit is closed.
+func (t *Tracker) relayConn(address string, lines chan string, quit chan struct{}) {
+	for {
+		conn, err := net.DialTimeout("tcp", address, 10*time.Second)
+		if err == nil {
+			done := make(chan struct{})
+			go func() {
+				s := bufio.NewScanner(conn)
+				for s.Scan() {
+					t.relayLine(s.Text())
+				}
+				close(done)
+			}()
+		send:
+			for {
+				select {
+				case line := <-lines:
+					if _, err = conn.Write([]byte(line + "\n")); err != nil {
+						break send
+					}
+				case <-done:
+					break send
+				case <-quit:
+					conn.Close()
+					return
+				}
+			}
+			conn.Close()
+		}
+		if err != nil {
+			fmt.Println("relay:", err)
+		}
+		select {
+		case <-quit:
+			return
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
+
+//remember records a relayed line.
+func (r *relayPolicy) remember(line string) {
+	r.recent = append(r.recent, line)
+	if len(r.recent) > relayRecent {
+		r.recent = r.recent[len(r.recent)-relayRecent:]
+	}
+}
+
+//echo returns true if line was relayed lately.
+func (r *relayPolicy) echo(line string) bool {
+	return contains(r.recent, strings.TrimSpace(line))
+}
+
+//relaySend queues a line for the external channel.
+func (t *Tracker) relaySend(d relayed) {
+	r := &t.relay
+	d.Server = t.ID
+	var b bytes.Buffer
+	if r.Mode == "webhook" {
+		if r.Hook.queue == nil || r.Hook.tmpl.Execute(&b, d) != nil {
+			return
+		}
+		select {
+		case r.Hook.queue <- b.Bytes():
+		default:
+			fmt.Println("relay: queue full")
+		}
+		return
+	}
+	if r.lines == nil || r.out.Execute(&b, d) != nil {
+		return
+	}
+	line := strings.Replace(b.String(), "\n", " ", -1)
+	r.remember(line)
+	select {
+	case r.lines <- line:
+	default:
+		fmt.Println("relay: queue full")
+	}
+}
+
+//relayOut mirrors a player's chat message to the external channel. Messages from
+//the server itself (including relayed ones) & commands are not sent.
+func (t *Tracker) relayOut(m *message) {
+	r := &t.relay
+	id, err := strconv.Atoi(m.Pid)
+	if !r.Enabled || m.IsCommand || err != nil || id < 0 || id >= len(t.players) || t.players[id].Name != m.Origin {
+		return
+	}
+	if len(r.Channels) > 0 && !contains(r.Channels, m.Type) || r.echo(m.Text) {
+		return
+	}
+	t.relaySend(relayed{Name: m.Origin, Team: t.players[id].team(), Type: m.Type, Text: m.Text})
+}
+
+//relayLine handles a line from the tcp connection.
+func (t *Tracker) relayLine(line string) {
+	t.mu.Lock()
+	if t.relay.echo(line) {
+		t.mu.Unlock()
+		return
+	}
+	name, text := "", line
+	if i := strings.Index(line, ": "); i > 0 {
+		name, text = line[:i], line[i+2:]
+	}
+	err := t.connected()
+	if err == nil {
+		err = t.relayIn(name, text)
+	}
+	if err != nil {
+		t.relaySend(relayed{Name: "gorcon", Text: err.Error()})
+	}
+	chat := t.relay.take()
+	t.mu.Unlock()
+	t.relayChat(chat)
+}
+
+//Relay brings a message from the external channel into the game.
+func (t *Tracker) Relay(name, text string) error {
+	if err := t.connected(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	err := t.relayIn(name, text)
+	chat := t.relay.take()
+	t.mu.Unlock()
+	t.relayChat(chat)
+	return err
+}
+
+//take returns & clears the chat lines left by relayIn. Callers must hold t.mu.
+func (r *relayPolicy) take() (lines []string) {
+	lines, r.chat = r.chat, nil
+	return
+}
+
+//relayChat sends lines to game chat. Called without t.mu, as Enqueue waits while
+//rcon is down.
+func (t *Tracker) relayChat(lines []string) {
+	for _, line := range lines {
+		t.Rcon.Enqueue("bf2cc sendserverchat " + line)
+	}
+}
+
+//relayIn runs an allowed command or leaves the message for relayChat to send to
+//game chat. Commands count towards the rate limit too.
+func (t *Tracker) relayIn(name, text string) error {
+	r := &t.relay
+	if !r.Enabled {
+		return errors.New("relay is disabled")
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	now := time.Now()
+	for len(r.let) > 0 && now.Sub(r.let[0]) > time.Minute {
+		r.let = r.let[1:]
+	}
+	if r.PerMinute > 0 && len(r.let) >= r.PerMinute {
+		return errors.New("too many messages, slow down")
+	}
+	r.let = append(r.let, now)
+	if strings.HasPrefix(text, "!") {
+		return t.relayCommand(strings.Fields(text[1:]))
+	}
+	if r.MaxLength > 0 && len(text) > r.MaxLength { //cut on a rune boundary
+		cut := r.MaxLength
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text = text[:cut]
+	}
+	var b bytes.Buffer
+	if err := r.in.Execute(&b, relayed{Server: t.ID, Name: name, Text: text}); err != nil {
+		return err
+	}
+	line := strings.Replace(oneLine(b.String()), `"`, "'", -1)
+	r.remember(line)
+	r.chat = append(r.chat, line)
+	return nil
+}
+
+//relayCommand runs an allowed command for the external channel.
+func (t *Tracker) relayCommand(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	name := args[0]
+	if !contains(t.relay.Commands, name) {
+		return fmt.Errorf("command not allowed ('%s')", name)
+	}
+	var reply string
+	switch name {
+	case "players":
+		var names []string
+		for key := range t.players {
+			if t.players[key].Name != "" {
+				names = append(names, t.players[key].Name)
+			}
+		}
+		reply = fmt.Sprintf("%d players: %s", len(names), strings.Join(names, ", "))
+	case "status":
+		g := t.game
+		reply = fmt.Sprintf("%s - %s (%s), %s players, tickets %s/%s", g.Name, g.Map, g.Mode, g.Players, g.Ntickets, g.Rtickets)
+	default:
+		if _, ok := t.aliases[name]; !ok {
+			return fmt.Errorf("unknown command ('%s')", name)
+		}
+		text, err := t.render(name, context{Game: t.game, Args: args[1:], Line: strings.Join(args[1:], " ")})
+		if err != nil {
+			return fmt.Errorf("alias error ('%s')", name)
+		}
+		reply = text
+	}
+	t.relaySend(relayed{Name: "gorcon", Text: reply})
+	return nil
+}
@@ -0,0 +1,196 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+relay tests run the tcp relay against an in-process stand-in for the external line
+server.
+*/
+
+//
+package track
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+//lineServer is a stand-in for the external channel's line server. Lines sent by
+//the relay arrive on lines.
+type lineServer struct {
+	addr  string
+	lines chan string
+	conns chan net.Conn
+	conn  net.Conn
+}
+
+//newLineServer listens for the relay's connection.
+func newLineServer(t *testing.T) *lineServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &lineServer{addr: ln.Addr().String(), lines: make(chan string, 100), conns: make(chan net.Conn, 1)}
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		s.conns <- c
+		sc := bufio.NewScanner(c)
+		for sc.Scan() {
+			s.lines <- sc.Text()
+		}
+	}()
+	return s
+}
+
+//send writes a line to the relay once it is connected.
+func (s *lineServer) send(t *testing.T, line string) {
+	t.Helper()
+	if s.conn == nil {
+		select {
+		case s.conn = <-s.conns:
+		case <-time.After(5 * time.Second):
+			t.Fatal("relay did not connect")
+		}
+	}
+	fmt.Fprintln(s.conn, line)
+}
+
+//expect fails unless the next line sent by the relay is want.
+func (s *lineServer) expect(t *testing.T, want string) {
+	t.Helper()
+	select {
+	case l := <-s.lines:
+		if l != want {
+			t.Errorf("relay sent %q, want %q", l, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("relay sent nothing, want %q", want)
+	}
+}
+
+//relayTracker returns a test Tracker relaying to a new line server. change edits the
+//default relay policy before it starts.
+func relayTracker(t *testing.T, change func(r *relayPolicy)) (*Tracker, <-chan string, *lineServer) {
+	tr, lines := testTracker(t)
+	players(tr)
+	s := newLineServer(t)
+	tr.relay = defaultRelayPolicy()
+	tr.relay.Enabled, tr.relay.Address = true, s.addr
+	if change != nil {
+		change(&tr.relay)
+	}
+	if err := tr.relay.compile(); err != nil {
+		t.Fatal(err)
+	}
+	tr.startRelay()
+	t.Cleanup(func() {
+		tr.mu.Lock()
+		tr.relay.stop()
+		tr.mu.Unlock()
+	})
+	return tr, lines, s
+}
+
+//expectChat fails unless the next rcon command is game chat reading want.
+func expectChat(t *testing.T, lines <-chan string, want string) {
+	t.Helper()
+	if l := next(t, lines); l != "bf2cc sendserverchat "+want {
+		t.Errorf("got %q, want chat %q", l, want)
+	}
+}
+
+func TestRelayOut(t *testing.T) {
+	tr, _, s := relayTracker(t, nil)
+	handled(t, tr, "1\tBob\t1\tGlobal\t[21:20:00]\thello\r"+
+		"2\tAlice\t2\tTeam\t[21:20:01]\tteam only\r"+
+		"1\tBob\t1\tGlobal\t[21:20:02]\t!args x\r"+
+		"-1\tAdmin\t0\tServerMessage\t[21:20:03]\tserver says\r"+
+		"2\tAlice\t2\tGlobal\t[21:20:04]\tbye")
+	s.expect(t, "Bob: hello")
+	s.expect(t, "Alice: bye")
+}
+
+func TestRelayIn(t *testing.T) {
+	_, lines, s := relayTracker(t, nil)
+	s.send(t, "Carol: hi there")
+	expectChat(t, lines, "[chat] Carol: hi there")
+	s.send(t, `no name "quoted"`)
+	expectChat(t, lines, "[chat] : no name 'quoted'")
+}
+
+func TestRelayEcho(t *testing.T) {
+	tr, lines, s := relayTracker(t, nil)
+	handled(t, tr, "1\tBob\t1\tGlobal\t[21:21:00]\thello")
+	s.expect(t, "Bob: hello")
+	s.send(t, "Bob: hello") //the channel echoing our own line
+	s.send(t, "Carol: ok")
+	expectChat(t, lines, "[chat] Carol: ok")
+	handled(t, tr, "-1\tAdmin\t0\tServerMessage\t[21:21:05]\t[chat] Carol: ok\r"+
+		"2\tAlice\t2\tGlobal\t[21:21:06]\t[chat] Carol: ok\r"+
+		"2\tAlice\t2\tGlobal\t[21:21:07]\tafter")
+	s.expect(t, "Alice: after")
+}
+
+func TestRelayRateLimit(t *testing.T) {
+	_, lines, s := relayTracker(t, func(r *relayPolicy) { r.PerMinute = 2 })
+	s.send(t, "Carol: one")
+	s.send(t, "Carol: two")
+	s.send(t, "Carol: three")
+	s.send(t, "Carol: !players")
+	expectChat(t, lines, "[chat] Carol: one")
+	expectChat(t, lines, "[chat] Carol: two")
+	s.expect(t, "gorcon: too many messages, slow down")
+	s.expect(t, "gorcon: too many messages, slow down")
+}
+
+func TestRelayCommands(t *testing.T) {
+	_, _, s := relayTracker(t, func(r *relayPolicy) { r.Commands = []string{"players", "args"} })
+	s.send(t, "Carol: !players")
+	s.expect(t, "gorcon: 2 players: Bob, Alice")
+	s.send(t, "Carol: !args a b")
+	s.expect(t, "gorcon: 2:[a][b]")
+	s.send(t, "Carol: !status")
+	s.expect(t, "gorcon: command not allowed ('status')")
+	s.send(t, "Carol: !kick Bob")
+	s.expect(t, "gorcon: command not allowed ('kick')")
+}
+
+func TestRelayMaxLength(t *testing.T) {
+	tr, lines, _ := relayTracker(t, func(r *relayPolicy) { r.MaxLength = 4 })
+	if err := tr.Relay("Carol", "añño 2024"); err != nil { //ñ is 2 bytes, byte 4 is inside the second
+		t.Fatal(err)
+	}
+	expectChat(t, lines, "[chat] Carol: añ")
+	if err := tr.Relay("Carol", "abcdefgh"); err != nil {
+		t.Fatal(err)
+	}
+	expectChat(t, lines, "[chat] Carol: abcd")
+}
+
+func TestRelayOutage(t *testing.T) {
+	tr, _, s := relayTracker(t, nil)
+	tr.Rcon.Close()
+	for i := 0; i < 3; i++ {
+		s.send(t, "Carol: anyone there?")
+		s.expect(t, "gorcon: rcon is not connected")
+	}
+	done := make(chan struct{})
+	go func() {
+		tr.Status()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay blocked the tracker during an outage")
+	}
+}
@@ -0,0 +1,212 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+resolve methods are used to find the player(s) a command is aimed at.
+*/
+
+//
+package track
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//choice is a pending 'pick' for a command that matched more than one player.
+type choice struct {
+	Command string
+	Args    []string
+	Options []int
+	Names   []string
+	Time    time.Time
+}
+
+//choiceTimeout is how long a numbered list stays valid for 'pick'.
+const choiceTimeout = 60 * time.Second
+
+/*
+resolve returns the slots matching term for the player in slot caller. Terms are
+tried in order, the first stage with any results wins:
+
+	#3                          - slot id.
+	@all @royal @national @me   - selectors.
+	exact name, name prefix, name substring (all case-insensitive).
+	fuzzy name (with or without a clan tag, see typos).
+
+Fuzzy is true when the results only come from the fuzzy stage.
+*/
+func (t *Tracker) resolve(caller int, term string) (results []int, fuzzy bool) {
+	term = strings.ToLower(strings.TrimSpace(term))
+	if term == "" {
+		return
+	}
+	if strings.HasPrefix(term, "#") {
+		if id, err := strconv.Atoi(term[1:]); err == nil && id >= 0 && id < len(t.players) && t.players[id].Name != "" {
+			results = append(results, id)
+		}
+		return
+	}
+	if strings.HasPrefix(term, "@") {
+		for key := range t.players {
+			p := &t.players[key]
+			if p.Name == "" {
+				continue
+			}
+			switch {
+			case term == "@all",
+				term == "@national" && p.Team == "1",
+				term == "@royal" && p.Team == "2",
+				term == "@me" && key == caller:
+				results = append(results, key)
+			}
+		}
+		return
+	}
+	edits := typos(term)
+	stages := []func(name string) bool{
+		func(name string) bool { return name == term },
+		func(name string) bool { return strings.HasPrefix(name, term) },
+		func(name string) bool { return strings.Contains(name, term) },
+		func(name string) bool {
+			return distance(name, term) <= edits || distance(untagged(name), term) <= edits
+		},
+	}
+	for i, match := range stages {
+		if i == len(stages)-1 && edits == 0 {
+			break
+		}
+		for key := range t.players {
+			name := strings.ToLower(t.players[key].Name)
+			if name != "" && match(name) {
+				results = append(results, key)
+			}
+		}
+		if len(results) > 0 {
+			return results, i == len(stages)-1
+		}
+	}
+	return
+}
+
+//typos returns the edits allowed for a fuzzy match of term: none below 4 letters,
+//1 below 8 & 2 from there on, so short terms don't match unrelated names.
+func typos(term string) int {
+	n := len([]rune(term))
+	switch {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	}
+	return 2
+}
+
+//untagged returns name with a leading clan tag like [ABC] or {ABC} removed.
+func untagged(name string) string {
+	for _, pair := range []string{"[]", "{}", "()", "<>", "||"} {
+		if strings.HasPrefix(name, pair[:1]) {
+			if i := strings.Index(name[1:], pair[1:]); i >= 0 {
+				return strings.TrimSpace(name[i+2:])
+			}
+		}
+	}
+	return name
+}
+
+//distance returns the Levenshtein edit distance between a & b.
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+/*
+target resolves args[0] to a single player for command. When several players match,
+or the match is only a fuzzy one, the caller is sent a numbered list & the command is
+held until they 'pick' one. Returns false if no single player was found.
+*/
+func (t *Tracker) target(id int, command string, args []string) (int, bool) {
+	if len(args) == 0 {
+		t.private(id, fmt.Sprintf("usage: !%s <player>", command))
+		return 0, false
+	}
+	r, fuzzy := t.resolve(id, args[0])
+	switch {
+	case len(r) == 0:
+		t.private(id, fmt.Sprintf("player not found ('%s')", args[0]))
+		return 0, false
+	case len(r) == 1 && !fuzzy:
+		return r[0], true
+	}
+	c := choice{Command: command, Args: args, Options: r, Time: time.Now()}
+	if fuzzy {
+		t.private(id, fmt.Sprintf("no player named '%s', did you mean (use !pick <number>):", args[0]))
+	} else {
+		t.private(id, fmt.Sprintf("multiple players found ('%s'), use !pick <number>:", args[0]))
+	}
+	for i, key := range r {
+		c.Names = append(c.Names, t.players[key].Name)
+		t.private(id, fmt.Sprintf("%d) %s", i+1, t.players[key].Name))
+	}
+	t.choices[id] = c
+	return 0, false
+}
+
+//pick handles the in-game 'pick <number>' command by re-running the held command
+//against the chosen player.
+func (t *Tracker) pick(id int, args []string) {
+	c, ok := t.choices[id]
+	if !ok || time.Since(c.Time) > choiceTimeout {
+		delete(t.choices, id)
+		t.private(id, "nothing to pick")
+		return
+	}
+	n := 0
+	if len(args) > 0 {
+		n, _ = strconv.Atoi(args[0])
+	}
+	if n < 1 || n > len(c.Options) {
+		t.private(id, fmt.Sprintf("pick a number from 1 to %d", len(c.Options)))
+		return
+	}
+	key := c.Options[n-1]
+	if t.players[key].Name != c.Names[n-1] {
+		delete(t.choices, id)
+		t.private(id, fmt.Sprintf("%s has left", c.Names[n-1]))
+		return
+	}
+	delete(t.choices, id)
+	args = append([]string{"#" + strconv.Itoa(key)}, c.Args[1:]...)
+	t.run(id, c.Command, args)
+}
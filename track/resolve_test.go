@@ -0,0 +1,76 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+resolve tests check how command arguments are matched to players.
+*/
+
+//
+package track
+
+import (
+	"reflect"
+	"testing"
+)
+
+//resolveTracker returns a Tracker with a few similar names on the server.
+func resolveTracker() *Tracker {
+	tr := &Tracker{}
+	for key, name := range map[int]string{1: "Bob", 2: "Alice", 3: "[ABC]Alexander", 4: "Bobby", 5: "Charlie"} {
+		tr.players[key] = player{Name: name, Team: string('1' + rune(key%2))}
+	}
+	return tr
+}
+
+func TestResolve(t *testing.T) {
+	tr := resolveTracker()
+	tests := []struct {
+		term  string
+		want  []int
+		fuzzy bool
+	}{
+		{"#2", []int{2}, false},
+		{"#9", nil, false},
+		{"BOB", []int{1}, false},          //exact beats the Bobby prefix
+		{"ali", []int{2}, false},          //prefix
+		{"xand", []int{3}, false},         //substring
+		{"bo", []int{1, 4}, false},        //ambiguous
+		{"charlee", []int{5}, true},       //1 typo
+		{"alexandr", []int{3}, true},      //without the clan tag
+		{"bov", nil, false},               //too short for a typo
+		{"chorloe", nil, false},           //2 typos in 7 letters
+		{"@national", []int{2, 4}, false}, //team 1
+		{"@me", []int{5}, false},          //the caller
+		{"", nil, false},
+	}
+	for _, test := range tests {
+		got, fuzzy := tr.resolve(5, test.term)
+		if !reflect.DeepEqual(got, test.want) || fuzzy != test.fuzzy {
+			t.Errorf("%q: got %v (fuzzy %v), want %v (fuzzy %v)", test.term, got, fuzzy, test.want, test.fuzzy)
+		}
+	}
+}
+
+//TestTargetFuzzy checks that a misspelled name is offered with !pick, not acted on.
+func TestTargetFuzzy(t *testing.T) {
+	tr, lines := testTracker(t)
+	players(tr)
+	tr.players[3] = player{Name: "Charlie", Team: "1", Nucleus: "1003"}
+	tr.admins["1001"] = admin{Name: "Bob", Roles: []string{"owner"}}
+	handled(t, tr, "1\tBob\t1\tGlobal\t[21:40:00]\t!kick charlee spam")
+	for _, want := range []string{
+		`exec game.sayToPlayerWithId 1 "no player named 'charlee', did you mean (use !pick <number>):"`,
+		`exec game.sayToPlayerWithId 1 "1) Charlie"`,
+	} {
+		if l := next(t, lines); l != want {
+			t.Errorf("got %q, want %q", l, want)
+		}
+	}
+	handled(t, tr, "1\tBob\t1\tGlobal\t[21:40:05]\t!pick 1")
+	if l := next(t, lines); l != `exec game.sayToPlayerWithId 3 "You have been kicked: spam"` {
+		t.Errorf("got %q", l)
+	}
+}
@@ -0,0 +1,244 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+roles and their methods are used to decide which players may run which commands.
+*/
+
+//
+package track
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+role is a named set of command permissions. Deny & Allow hold command names or
+"*" for every command. A role's own lists are checked before any inherited role so
+a role can narrow (or widen) what it inherits.
+*/
+type role struct {
+	Inherits    []string
+	Allow, Deny []string
+}
+
+//permissions holds the global role definitions and per-server overrides. An
+//override replaces the global role of the same name for that server only.
+type permissions struct {
+	Roles   map[string]role
+	Servers map[string]map[string]role
+}
+
+//defaultPermissions returns the roles used when 'roles.json' does not exist.
+func defaultPermissions() permissions {
+	return permissions{
+		Roles: map[string]role{
+			"player":    role{Allow: []string{"clan", "ready", "unready"}},
+			"vip":       role{Inherits: []string{"player"}},
+			"moderator": role{Inherits: []string{"vip"}, Allow: []string{"kick", "ban", "tempban", "info", "whois"}},
+			"trial":     role{Inherits: []string{"moderator"}, Deny: []string{"ban", "tempban"}},
+			"admin":     role{Inherits: []string{"moderator"}, Allow: []string{"*"}, Deny: []string{"grant", "revoke"}},
+			"owner":     role{Inherits: []string{"admin"}, Allow: []string{"*"}},
+		},
+		Servers: make(map[string]map[string]role),
+	}
+}
+
+//role returns the definition of the named role for the given server.
+func (p *permissions) role(server, name string) (r role, ok bool) {
+	if over, found := p.Servers[server]; found {
+		if r, ok = over[name]; ok {
+			return
+		}
+	}
+	r, ok = p.Roles[name]
+	return
+}
+
+//exists returns true if the named role is defined globally or for the server.
+func (p *permissions) exists(server, name string) bool {
+	_, ok := p.role(server, name)
+	return ok
+}
+
+/*
+decide walks the named role & its inherited roles looking for a rule about command.
+Returns "allow", "deny" or "" when no rule applies. The seen map guards against
+inheritance loops.
+*/
+func (p *permissions) decide(server, name, command string, seen map[string]bool) string {
+	if seen[name] {
+		return ""
+	}
+	seen[name] = true
+	r, ok := p.role(server, name)
+	if !ok {
+		return ""
+	}
+	if listed(r.Deny, command) {
+		return "deny"
+	}
+	if listed(r.Allow, command) {
+		return "allow"
+	}
+	for _, parent := range r.Inherits {
+		if d := p.decide(server, parent, command, seen); d != "" {
+			return d
+		}
+	}
+	return ""
+}
+
+//listed returns true if command or "*" is in list.
+func listed(list []string, command string) bool {
+	for _, v := range list {
+		if v == "*" || v == command {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+roles returns every role held by the player in slot id. All players hold "player"
+and VIPs hold "vip". Admins without any roles are mapped from their legacy Power:
+100 or more is "owner", anything above 0 is "moderator".
+*/
+func (t *Tracker) roles(id int) (list []string) {
+	p := t.players[id]
+	if a, ok := t.admins[p.Nucleus]; ok && p.Nucleus != "" {
+		list = append(list, a.Roles...)
+		if len(a.Roles) == 0 {
+			list = append(list, legacyRoles(a.Power)...)
+		}
+	}
+	if p.Vip == "1" {
+		list = append(list, "vip")
+	}
+	return append(list, "player")
+}
+
+//legacyRoles returns the roles an admin without any roles holds by legacy Power.
+func legacyRoles(power int) []string {
+	switch {
+	case power >= 100:
+		return []string{"owner"}
+	case power > 0:
+		return []string{"moderator"}
+	}
+	return nil
+}
+
+//hasRole returns true if the player in slot id holds the named role directly.
+func (t *Tracker) hasRole(id int, name string) bool {
+	for _, r := range t.roles(id) {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+permitted returns true if the player in slot id may run the named command. A role
+denying the command is final; otherwise any role allowing it is enough. Only when no
+role has a rule for the command is the legacy alias Power check used, with Power 0
+meaning public.
+*/
+func (t *Tracker) permitted(id int, command string) bool {
+	allowed := false
+	for _, r := range t.roles(id) {
+		switch t.perms.decide(t.ID, r, command, make(map[string]bool)) {
+		case "deny":
+			return false
+		case "allow":
+			allowed = true
+		}
+	}
+	if allowed {
+		return true
+	}
+	a, ok := t.aliases[command]
+	if !ok {
+		return false
+	}
+	if a.Power == 0 {
+		return true
+	}
+	if adm, ok := t.admins[t.players[id].Nucleus]; ok && t.players[id].Nucleus != "" {
+		return adm.Power >= a.Power
+	}
+	return false
+}
+
+//elevated returns true if the named command needs more than the "player" role,
+//following the same rules as permitted.
+func (t *Tracker) elevated(command string) bool {
+	switch t.perms.decide(t.ID, "player", command, make(map[string]bool)) {
+	case "allow":
+		return false
+	case "deny":
+		return true
+	}
+	a, ok := t.aliases[command]
+	return !ok || a.Power > 0
+}
+
+//grant handles the in-game 'grant <player> <role>' & 'revoke <player> <role>'
+//commands. Changes are written to 'admins.json'. A legacy Power is turned into the
+//roles it maps to & cleared, so it can't bring a revoked role back.
+func (t *Tracker) grant(id int, args []string, revoke bool) {
+	command := "grant"
+	if revoke {
+		command = "revoke"
+	}
+	if len(args) < 2 {
+		t.private(id, fmt.Sprintf("usage: !%s <player> <role>", command))
+		return
+	}
+	name := strings.ToLower(args[1])
+	if !t.perms.exists(t.ID, name) {
+		t.private(id, fmt.Sprintf("unknown role ('%s')", name))
+		return
+	}
+	key, ok := t.target(id, command, args)
+	if !ok {
+		return
+	}
+	p := t.players[key]
+	if p.Nucleus == "" {
+		t.private(id, fmt.Sprintf("no nucleus id for %s", p.Name))
+		return
+	}
+	a := t.admins[p.Nucleus]
+	a.Name = p.Name
+	if len(a.Roles) == 0 {
+		a.Roles = legacyRoles(a.Power)
+	}
+	a.Power = 0
+	var roles []string
+	for _, v := range a.Roles {
+		if v != name {
+			roles = append(roles, v)
+		}
+	}
+	if !revoke {
+		roles = append(roles, name)
+	}
+	a.Roles = roles
+	t.admins[p.Nucleus] = a
+	if err := writeJSON(t.path("admins.json"), &t.admins); err != nil {
+		fmt.Println(err)
+	}
+	if revoke {
+		t.moderated("revoke "+name, &p, t.players[id].Name, "", fmt.Sprintf("%s revoked %s from %s\n", t.players[id].Name, name, p.Name))
+		t.private(id, fmt.Sprintf("%s is no longer %s", p.Name, name))
+	} else {
+		t.moderated("grant "+name, &p, t.players[id].Name, "", fmt.Sprintf("%s granted %s to %s\n", t.players[id].Name, name, p.Name))
+		t.private(id, fmt.Sprintf("%s is now %s", p.Name, name))
+	}
+}
@@ -0,0 +1,110 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+roles tests check command permissions against the default roles.
+*/
+
+//
+package track
+
+import "testing"
+
+func TestPermitted(t *testing.T) {
+	tr := &Tracker{ID: "test", perms: defaultPermissions()}
+	tr.admins = map[string]admin{
+		"1": admin{Power: 100, Roles: []string{"trial"}},
+		"2": admin{Power: 100},
+		"3": admin{Power: 50, Roles: []string{"moderator"}},
+	}
+	tr.aliases = map[string]alias{
+		"ban":   alias{Power: 100, Message: "legacy ban"},
+		"rules": alias{Power: 0, Message: "be nice"},
+		"test":  alias{Power: 100, Message: "testing"},
+		"half":  alias{Power: 50, Message: "half"},
+	}
+	tr.players[0] = player{Name: "Trial", Nucleus: "1"}
+	tr.players[1] = player{Name: "Legacy", Nucleus: "2"}
+	tr.players[2] = player{Name: "Mod", Nucleus: "3"}
+	tr.players[3] = player{Name: "Nobody", Nucleus: "4"}
+	tests := []struct {
+		id      int
+		command string
+		want    bool
+	}{
+		{0, "kick", true},
+		{0, "ban", false}, //denied by trial despite Power 100 & the legacy alias
+		{0, "tempban", false},
+		{0, "test", true}, //no role rule: legacy Power
+		{1, "ban", true},  //Power 100 maps to owner
+		{1, "grant", true},
+		{2, "ban", true},
+		{2, "grant", false},
+		{2, "half", true},
+		{2, "test", false},
+		{3, "rules", true},
+		{3, "clan", true},
+		{3, "kick", false},
+		{3, "test", false},
+		{3, "unknown", false},
+	}
+	for _, test := range tests {
+		if got := tr.permitted(test.id, test.command); got != test.want {
+			t.Errorf("%s %s: got %v, want %v", tr.players[test.id].Name, test.command, got, test.want)
+		}
+	}
+}
+
+func TestElevated(t *testing.T) {
+	tr := &Tracker{ID: "test", perms: defaultPermissions()}
+	tr.aliases = map[string]alias{
+		"rules": alias{Power: 0, Message: "be nice"},
+		"say":   alias{Power: 100, Message: "{{.Line}}"},
+	}
+	tr.perms.Roles["player"] = role{Allow: []string{"clan", "ready", "unready"}, Deny: []string{"rules"}}
+	tests := map[string]bool{
+		"ready":   false,
+		"unready": false,
+		"clan":    false,
+		"rules":   true, //public alias denied to players
+		"say":     true,
+		"kick":    true,
+		"match":   true,
+		"whois":   true,
+	}
+	for command, want := range tests {
+		if got := tr.elevated(command); got != want {
+			t.Errorf("%s: got %v, want %v", command, got, want)
+		}
+	}
+	delete(tr.perms.Roles, "player")
+	if tr.elevated("rules") {
+		t.Error("public alias is elevated")
+	}
+}
+
+//TestRevokeLegacyOwner checks that revoking owner from the seeded admin, who only
+//has a legacy Power, takes effect.
+func TestRevokeLegacyOwner(t *testing.T) {
+	tr, lines := testTracker(t)
+	players(tr)
+	tr.admins = map[string]admin{
+		"1001": admin{Name: "Bob", Roles: []string{"owner"}},
+		"1002": admin{Name: "Alice", Power: 100},
+	}
+	handled(t, tr, "1\tBob\t1\tGlobal\t[21:30:00]\t!revoke Alice owner")
+	if l := next(t, lines); l != `exec game.sayToPlayerWithId 1 "Alice is no longer owner"` {
+		t.Errorf("got %q", l)
+	}
+	if tr.hasRole(2, "owner") || tr.permitted(2, "ban") {
+		t.Errorf("Alice still holds %v", tr.roles(2))
+	}
+	handled(t, tr, "1\tBob\t1\tGlobal\t[21:30:10]\t!grant Alice moderator")
+	next(t, lines)
+	if a := tr.admins["1002"]; a.Power != 0 || len(a.Roles) != 1 || a.Roles[0] != "moderator" {
+		t.Errorf("admin = %+v", a)
+	}
+}
@@ -0,0 +1,219 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+schedule methods are used to send timed & event driven server announcements. The
+schedule is kept in 'schedule.json'.
+*/
+
+//
+package track
+
+import (
+	"fmt"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+/*
+announcement is a pool of messages sent in turn whenever one of its triggers fires.
+Messages are templates (see alias templates) with .Game set.
+
+	Every      - send at this interval ("15m").
+	Cron       - send on a cron expression ("0 * * * *").
+	RoundStart - send when a new round starts.
+	Players    - send when the player count rises to this number.
+*/
+type announcement struct {
+	Messages   []string
+	Every      string
+	Cron       string
+	RoundStart bool
+	Players    int
+	next       int
+	every      time.Duration
+	cron       *cron
+	templates  []*template.Template
+	last       time.Time
+}
+
+//schedule holds all announcements. No announcements are sent between Quiet.Start &
+//Quiet.End ("HH:MM", may wrap past midnight).
+type schedule struct {
+	Quiet struct {
+		Start, End string
+	}
+	Announcements []*announcement
+}
+
+//defaultSchedule returns the schedule used when 'schedule.json' does not exist.
+func defaultSchedule() schedule {
+	return schedule{
+		Announcements: []*announcement{
+			&announcement{
+				Messages: []string{
+					"Rules: Be respectful. Help your team. No cheating, no whining, no badmouthing, no idling, no t-bagging. no soliciting.",
+					"Welcome to {{.Game.Name}}. Type !rules to see the server rules.",
+				},
+				Every: "15m",
+			},
+			&announcement{
+				Messages:   []string{"Now playing {{.Game.Map}} ({{.Game.Mode}}). Good luck!"},
+				RoundStart: true,
+			},
+		},
+	}
+}
+
+//compile parses the intervals, cron expressions & message templates. Templates are
+//run against sample data so mistakes are reported when the schedule is loaded.
+func (s *schedule) compile() error {
+	for _, hm := range []string{s.Quiet.Start, s.Quiet.End} {
+		if _, err := clock(hm); err != nil {
+			return err
+		}
+	}
+	for i, a := range s.Announcements {
+		var err error
+		a.every, a.cron, a.templates, a.last = 0, nil, nil, time.Now()
+		if a.Every != "" {
+			if a.every, err = time.ParseDuration(a.Every); err != nil {
+				return err
+			}
+		}
+		if a.Cron != "" {
+			if a.cron, err = parseCron(a.Cron); err != nil {
+				return err
+			}
+		}
+		for j, m := range a.Messages {
+			tmpl, err := template.New(fmt.Sprintf("announcement %d.%d", i, j)).Funcs(funcs).Parse(m)
+			if err == nil {
+				_, err = execute(tmpl, context{})
+			}
+			if err != nil {
+				return err
+			}
+			a.templates = append(a.templates, tmpl)
+		}
+	}
+	return nil
+}
+
+//clock parses "HH:MM" into minutes since midnight. Empty strings are -1.
+func clock(hm string) (int, error) {
+	if hm == "" {
+		return -1, nil
+	}
+	tm, err := time.Parse("15:04", hm)
+	if err != nil {
+		return -1, err
+	}
+	return tm.Hour()*60 + tm.Minute(), nil
+}
+
+//quiet returns true if tm falls within quiet hours.
+func (s *schedule) quiet(tm time.Time) bool {
+	start, _ := clock(s.Quiet.Start)
+	end, _ := clock(s.Quiet.End)
+	if start < 0 || end < 0 || start == end {
+		return false
+	}
+	now := tm.Hour()*60 + tm.Minute()
+	if start < end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+//announcement returns the next message from a, "" when there is nothing to send.
+//Callers must hold t.mu.
+func (t *Tracker) announcement(a *announcement) string {
+	a.last = time.Now()
+	if len(a.templates) == 0 || t.schedule.quiet(a.last) {
+		return ""
+	}
+	tmpl := a.templates[a.next%len(a.templates)]
+	a.next++
+	text, err := execute(tmpl, context{Game: t.game})
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	return text
+}
+
+//announce sends the next message from a. Callers must hold t.mu.
+func (t *Tracker) announce(a *announcement) {
+	if text := t.announcement(a); text != "" {
+		t.Rcon.Enqueue("bf2cc sendserverchat " + text)
+	}
+}
+
+//announcer sends interval & cron announcements. Checked every few seconds, cron
+//announcements fire at most once per minute. Nothing is sent while rcon is down and
+//messages are sent after t.mu is released, as Enqueue waits for the connection.
+func (t *Tracker) announcer() {
+	var minute time.Time
+	quit := t.stopper()
+	for {
+		now := time.Now()
+		var texts []string
+		t.mu.Lock()
+		due := func(a *announcement) {
+			if text := t.announcement(a); text != "" {
+				texts = append(texts, text)
+			}
+		}
+		if t.Rcon.Ready() {
+			for _, a := range t.schedule.Announcements {
+				if a.every > 0 && now.Sub(a.last) >= a.every {
+					due(a)
+				}
+			}
+			if m := now.Truncate(time.Minute); !m.Equal(minute) {
+				minute = m
+				for _, a := range t.schedule.Announcements {
+					if a.cron != nil && a.cron.match(now) {
+						due(a)
+					}
+				}
+			}
+		}
+		t.mu.Unlock()
+		for _, text := range texts {
+			t.Rcon.Enqueue("bf2cc sendserverchat " + text)
+		}
+		select {
+		case <-quit:
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+//gameEvents sends announcements triggered by changes between two game updates.
+//Callers must hold t.mu.
+func (t *Tracker) gameEvents(before, after game) {
+	elapsedBefore, _ := strconv.Atoi(before.Elapsed)
+	elapsedAfter, _ := strconv.Atoi(after.Elapsed)
+	started := before.Map != "" && (before.Map != after.Map || elapsedAfter < elapsedBefore)
+	countBefore, _ := strconv.Atoi(before.Players)
+	countAfter, _ := strconv.Atoi(after.Players)
+	if started {
+		t.endClanRound(before)
+		t.notify("round end", fmt.Sprintf("round on %s ended", before.Map), before)
+	}
+	if countBefore > 0 && countAfter == 0 {
+		t.notify("empty", "the server is empty", nil)
+	}
+	for _, a := range t.schedule.Announcements {
+		if (a.RoundStart && started) || (a.Players > 0 && countBefore < a.Players && countAfter >= a.Players) {
+			t.announce(a)
+		}
+	}
+}
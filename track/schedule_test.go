@@ -0,0 +1,44 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+schedule tests check the announcer during rcon outages.
+*/
+
+//
+package track
+
+import (
+	"testing"
+	"time"
+)
+
+//TestAnnouncerOutage checks that the announcer doesn't hold t.mu while rcon is down.
+func TestAnnouncerOutage(t *testing.T) {
+	tr, _ := testTracker(t)
+	a := announcement{Messages: []string{"hello"}, Every: "1ms"}
+	b, c := a, a
+	tr.schedule = schedule{Announcements: []*announcement{&a, &b, &c}}
+	if err := tr.schedule.compile(); err != nil {
+		t.Fatal(err)
+	}
+	tr.Rcon.Close()
+	time.Sleep(10 * time.Millisecond) //all announcements are due
+	quit := tr.stopper()
+	defer close(quit)
+	go tr.announcer()
+	time.Sleep(50 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		tr.Status()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("announcer blocked the tracker during an outage")
+	}
+}
@@ -0,0 +1,154 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+template methods are used to render alias messages with text/template.
+*/
+
+//
+package track
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+/*
+context is the data available to alias message templates.
+
+	.Caller - player that used the command.
+	.Target - player named by the first argument (nil when there isn't exactly one,
+	          so guard it with {{if .Target}} outside of 'info').
+	.Player - Target for 'info', otherwise Caller. Used by the legacy $TAG$ tags.
+	.Game   - current game state.
+	.Args   - command arguments.
+	.Line   - command arguments joined by spaces.
+*/
+type context struct {
+	Caller, Target, Player *player
+	Game                   game
+	Args                   []string
+	Line                   string
+}
+
+//funcs are the functions available to alias message templates.
+var funcs = template.FuncMap{
+	"team":  func(p *player) string { return p.team() },
+	"enemy": enemy,
+	"size":  func(g game, p *player) string { return g.size(p.Team) },
+	"vip":   func(p *player) bool { return p.Vip == "1" },
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"join":  strings.Join,
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"default": func(d, s string) string {
+		if s == "" {
+			return d
+		}
+		return s
+	},
+}
+
+//legacyTags matches the old $TAG$ style tags.
+var legacyTags = regexp.MustCompile(`\$+[A-Z]+\$`)
+
+//legacy maps old $TAG$ style tags to their template equivalents.
+var legacy = map[string]string{
+	"$PN$":   "{{.Player.Name}}",
+	"$PL$":   "{{.Player.Level}}",
+	"$PT$":   "{{team .Player}}",
+	"$PC$":   "{{.Player.Kit}}",
+	"$ET$":   "{{enemy .Player}}",
+	"$PTN$":  "{{size .Game .Player}}",
+	"$VIP$":  "{{if vip .Player}}VIP{{end}}",
+	"$PING$": "{{.Player.Ping}}",
+}
+
+//enemy returns the name of the team opposing p.
+func enemy(p *player) string {
+	switch p.Team {
+	case "1":
+		return "Royal"
+	case "2":
+		return "National"
+	}
+	return p.Team
+}
+
+//size returns the number of players on the given team.
+func (g *game) size(team string) string {
+	if team == "1" {
+		return g.Nsize
+	}
+	return g.Rsize
+}
+
+/*
+convert returns the template text for an alias message. Messages without any
+template actions are treated as legacy messages: $TAG$ tags are translated & the
+command arguments are appended as before.
+*/
+func convert(m string) string {
+	if strings.Contains(m, "{{") {
+		return m
+	}
+	m = legacyTags.ReplaceAllStringFunc(m, func(tag string) string {
+		return legacy[tag]
+	})
+	return m + " {{.Line}}"
+}
+
+/*
+compile parses every alias message into a template. Templates are also run against
+sample data, with & without a Target, so unknown fields & functions and unguarded
+uses of .Target are caught at load time. Aliases that fail are reported & removed.
+*/
+func (t *Tracker) compile() {
+	t.templates = make(map[string]*template.Template)
+	var p player
+	sample := context{Caller: &p, Target: &p, Player: &p}
+	for name, a := range t.aliases {
+		tmpl, err := template.New(name).Funcs(funcs).Parse(convert(a.Message))
+		if err == nil {
+			err = tmpl.Execute(ioutil.Discard, sample)
+		}
+		if err == nil && name != "info" { //only info always has a target
+			err = tmpl.Execute(ioutil.Discard, context{Caller: &p, Player: &p})
+		}
+		if err != nil {
+			fmt.Printf("alias %s: %s\n", name, err)
+			delete(t.aliases, name)
+			continue
+		}
+		t.templates[name] = tmpl
+	}
+}
+
+//render executes the template for the named alias.
+func (t *Tracker) render(name string, ctx context) (string, error) {
+	tmpl, ok := t.templates[name]
+	if !ok {
+		return "", fmt.Errorf("no template for alias '%s'", name)
+	}
+	return execute(tmpl, ctx)
+}
+
+//execute runs tmpl with ctx & returns the result trimmed of surrounding whitespace.
+func execute(tmpl *template.Template, ctx context) (string, error) {
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, ctx); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
@@ -0,0 +1,31 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+template tests check that alias templates are validated the way they are run.
+*/
+
+//
+package track
+
+import "testing"
+
+//TestCompileTarget checks that unguarded uses of .Target are rejected at load time.
+func TestCompileTarget(t *testing.T) {
+	tr := &Tracker{aliases: map[string]alias{
+		"info":    {Message: "{{.Target.Name}}"},
+		"slap":    {Message: "{{.Caller.Name}} slaps {{.Target.Name}}"},
+		"salute":  {Message: "{{.Caller.Name}} salutes{{if .Target}} {{.Target.Name}}{{end}}"},
+		"legacy":  {Message: "$PN$ is on the $PT$"},
+		"unknown": {Message: "{{.Caller.Nope}}"},
+	}}
+	tr.compile()
+	for name, ok := range map[string]bool{"info": true, "slap": false, "salute": true, "legacy": true, "unknown": false} {
+		if _, found := tr.templates[name]; found != ok {
+			t.Errorf("alias %s compiled: %v, want %v", name, found, ok)
+		}
+	}
+}
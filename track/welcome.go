@@ -0,0 +1,125 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+welcome methods are used to greet players as they connect. Messages are kept in
+'welcome.json' and the first & last time each nucleus id was seen in 'seen.json'.
+*/
+
+//
+package track
+
+import (
+	"fmt"
+	"text/template"
+	"time"
+)
+
+/*
+welcomePolicy configures join greetings. Messages are templates (see alias
+templates) with .Caller & .Player set to the new player. Empty messages are not
+sent.
+
+	First     - private message for a player never seen before.
+	Returning - private message for a player seen before.
+	VIP       - private message for VIPs (instead of First/Returning).
+	Admin     - private message for players holding an Admins role.
+	Announce  - public message for players wearing a clan tag (see 'clans.json').
+	            Empty by default, as the default patterns match any tag.
+*/
+type welcomePolicy struct {
+	Enabled                                bool
+	First, Returning, VIP, Admin, Announce string
+	Admins                                 []string
+	templates                              map[string]*template.Template
+}
+
+//sighting records when a nucleus id was first & last seen, & the names it used.
+type sighting struct {
+	Name, Profileid string
+	First, Last     time.Time
+	Visits          int
+	Names           []usedName
+}
+
+//defaultWelcomePolicy returns the policy used when 'welcome.json' does not exist.
+func defaultWelcomePolicy() welcomePolicy {
+	return welcomePolicy{
+		Enabled:   true,
+		First:     "Welcome to {{.Game.Name}}, {{.Caller.Name}}! Type !rules to see the server rules.",
+		Returning: "Welcome back, {{.Caller.Name}}!",
+		VIP:       "Welcome back, {{.Caller.Name}}. Thanks for being a VIP!",
+		Admin:     "Welcome back, {{.Caller.Name}}. Admin commands are enabled.",
+		Admins:    []string{"trial", "moderator", "admin", "owner"},
+	}
+}
+
+//compile parses the welcome templates. Templates are run against sample data so
+//mistakes are reported when the policy is loaded.
+func (w *welcomePolicy) compile() error {
+	w.templates = make(map[string]*template.Template)
+	var p player
+	sample := context{Caller: &p, Player: &p}
+	for name, text := range map[string]string{
+		"first":     w.First,
+		"returning": w.Returning,
+		"vip":       w.VIP,
+		"admin":     w.Admin,
+		"announce":  w.Announce,
+	} {
+		if text == "" {
+			continue
+		}
+		tmpl, err := template.New(name).Funcs(funcs).Parse(text)
+		if err == nil {
+			_, err = execute(tmpl, sample)
+		}
+		if err != nil {
+			return err
+		}
+		w.templates[name] = tmpl
+	}
+	return nil
+}
+
+//welcome greets the player in slot key after they connect & records the visit.
+func (t *Tracker) welcome(key int) {
+	p := &t.players[key]
+	pol := &t.welcomes
+	known := false
+	if p.key() != "" {
+		_, known = t.sight(p)
+	}
+	if _, banned := t.banOf(p); banned || !pol.Enabled {
+		return
+	}
+	name := "returning"
+	switch {
+	case t.exempt(key, pol.Admins):
+		name = "admin"
+	case p.Vip == "1":
+		name = "vip"
+	case !known:
+		name = "first"
+	}
+	ctx := context{Caller: p, Player: p, Game: t.game}
+	if tmpl, ok := pol.templates[name]; ok {
+		if text, err := execute(tmpl, ctx); err != nil {
+			fmt.Println(err)
+		} else if text != "" {
+			t.private(key, text)
+		}
+	}
+	if t.clanOf(p.Name) != "" {
+		if tmpl, ok := pol.templates["announce"]; ok {
+			if text, err := execute(tmpl, ctx); err != nil {
+				fmt.Println(err)
+			} else if text != "" {
+				t.Rcon.Enqueue("bf2cc sendserverchat " + text)
+			}
+		}
+	}
+}
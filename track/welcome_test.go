@@ -0,0 +1,31 @@
+/*
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+gorcon/track (lee8oi)
+
+welcome tests check the clan announcement.
+*/
+
+//
+package track
+
+import "testing"
+
+//TestWelcomeClan checks that players are announced by the 'clans.json' patterns.
+func TestWelcomeClan(t *testing.T) {
+	tr, lines := testTracker(t)
+	players(tr)
+	tr.welcomes = welcomePolicy{Enabled: true, Announce: "Clan member {{.Caller.Name}} joined"}
+	if err := tr.welcomes.compile(); err != nil {
+		t.Fatal(err)
+	}
+	tr.players[2].Name = "=ABC=Alice"
+	tr.welcome(1)
+	tr.welcome(2)
+	want := "bf2cc sendserverchat Clan member =ABC=Alice joined"
+	if l := next(t, lines); l != want {
+		t.Errorf("got %q, want %q", l, want)
+	}
+}